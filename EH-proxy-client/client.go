@@ -36,11 +36,17 @@ func init() {
 func printHelp() {
 	fmt.Println("-----help-----")
 	fmt.Println("info\t" + "show EasyProxy infomation")
-	fmt.Println("AddServer [addr] [weight] [probe]\t" + "add server to proxy")
-	fmt.Println("DeleteServer [addr]\t" + "delete server from proxy")
-	fmt.Println("GetServer [addr]\t" + "get specified server information")
-	fmt.Println("Exists [addr]\t" + "query specified server exists or not")
-	fmt.Println("SetWeight [addr]\t" + "set the weight of specified server")
+	fmt.Println("AddServer [@group] [addr] [weight] [probe]\t" + "add server to proxy")
+	fmt.Println("DeleteServer [@group] [addr]\t" + "delete server from proxy")
+	fmt.Println("GetServer [@group] [addr]\t" + "get specified server information")
+	fmt.Println("Exists [@group] [addr]\t" + "query specified server exists or not")
+	fmt.Println("SetWeight [@group] [addr]\t" + "set the weight of specified server")
+	fmt.Println("SetLoadBalancer [@group] [type]\t" + "switch the load balancing algorithm at runtime")
+	fmt.Println("SetDrain [@group] [addr] [true/false]\t" + "stop or resume sending new requests to the server")
+	fmt.Println("SetSplit [route] [group:weight]...\t" + "change the traffic split of the route between server groups")
+	fmt.Println("AddPath [path]\t" + "add a path to the url path check list")
+	fmt.Println("DeletePath [path]\t" + "delete a path from the url path check list")
+	fmt.Println("ListPaths\t" + "list the paths of the url path check list")
 	fmt.Println("Shutdown\t" + "shutdown server gracefully")
 	fmt.Println("save\t" + "save proxy current server list to disk")
 	fmt.Println("-h / -help \t" + "display help")
@@ -0,0 +1,112 @@
+// lbsim 负载均衡模拟器
+// 使用模拟服务器（可配置处理时间、并发处理能力与故障）回放合成或记录的请求轨迹，
+// 比较不同负载均衡算法的请求分配份额与权重的偏差、突发度、活跃请求数尾部以及服务器故障或删除时的表现
+//
+// 示例：
+//
+//	lbsim -lb round-robin,random,least-active -servers 100/10ms,100/10ms,200/10ms/4 \
+//		-requests 200000 -rate 5000 -fail 0@10s+10s -detect 2s -remove 1@30s
+package main
+
+import (
+	"EH-Proxy/pkg/slb"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBalancers = "round-robin,random,least-active"
+	defaultServers   = "100/10ms,100/10ms,100/10ms,200/10ms"
+	defaultRequests  = 100000
+	defaultRate      = 2000
+	defaultKeys      = 1000
+	defaultDetect    = 3 * time.Second
+	defaultWindow    = 100
+	defaultSeed      = 1
+)
+
+var (
+	balancers string
+	servers   string
+	requests  int
+	rate      float64
+	keys      int
+	tracePath string
+	fails     string
+	removes   string
+	detect    time.Duration
+	dist      string
+	window    int
+	seed      int64
+)
+
+func init() {
+	flag.StringVar(&balancers, "lb", defaultBalancers, "load balancer types to compare, separated by commas")
+	flag.StringVar(&servers, "servers", defaultServers, "simulated servers, weight/latency[/capacity] separated by commas")
+	flag.IntVar(&requests, "requests", defaultRequests, "number of synthetic requests")
+	flag.Float64Var(&rate, "rate", defaultRate, "synthetic request arrival rate (requests per second, poisson)")
+	flag.IntVar(&keys, "keys", defaultKeys, "number of distinct synthetic hash keys, 0 means no key")
+	flag.StringVar(&tracePath, "trace", "", "recorded trace file, each line: offset [key], overrides synthetic requests")
+	flag.StringVar(&fails, "fail", "", "server failures, index@time[+duration] separated by commas")
+	flag.StringVar(&removes, "remove", "", "server removals, index@time separated by commas")
+	flag.DurationVar(&detect, "detect", defaultDetect, "delay before the load balancer notices a failure or recovery")
+	flag.StringVar(&dist, "dist", distExp, "service time distribution: exp / const")
+	flag.IntVar(&window, "window", defaultWindow, "window size (requests) for burstiness")
+	flag.Int64Var(&seed, "seed", defaultSeed, "random seed")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "lbsim: "+err.Error())
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	if dist != distExp && dist != distConst {
+		fatal(fmt.Errorf("unknown distribution %q", dist))
+	}
+	if window < 1 {
+		window = defaultWindow
+	}
+	specs, err := parseServerSpecs(servers)
+	if err != nil {
+		fatal(err)
+	}
+	events, err := parseScenario(fails, removes, detect, len(specs))
+	if err != nil {
+		fatal(err)
+	}
+	var trace []traceEntry
+	if tracePath != "" {
+		trace, err = loadTrace(tracePath)
+		if err != nil {
+			fatal(err)
+		}
+	} else {
+		if rate <= 0 {
+			fatal(fmt.Errorf("rate must be positive"))
+		}
+		trace = generateTrace(requests, rate, keys, rand.New(rand.NewSource(seed)))
+	}
+	if len(trace) == 0 {
+		fatal(fmt.Errorf("empty trace"))
+	}
+	fmt.Printf("servers: %d  requests: %d  duration: %v  distribution: %s  window: %d\n\n",
+		len(specs), len(trace), trace[len(trace)-1].at, dist, window)
+
+	for _, name := range strings.Split(balancers, ",") {
+		balancerType := slb.LoadBalancerType(strings.TrimSpace(name))
+		if balancerType == "" {
+			continue
+		}
+		sim, err := newSimulator(balancerType, specs, dist, window, seed)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %v", balancerType, err))
+		}
+		sim.run(trace, events).print(os.Stdout, string(balancerType))
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// serverStats 单个服务器的统计数据
+type serverStats struct {
+	addr     string
+	weight   int32
+	selected int64   // 被选中次数
+	errors   int64   // 发送到实际故障服务器而失败的请求数
+	active   []int32 // 每次被选中时的活跃请求数
+	maxRun   int     // 最长连续被选中次数
+
+	windowSum   float64 // 各窗口内被选中次数之和
+	windowSqSum float64 // 各窗口内被选中次数的平方和
+}
+
+// phaseStats 一个统计阶段（两次场景事件之间）的数据
+type phaseStats struct {
+	start    time.Duration
+	label    string
+	selected []int64
+	weights  []int32 // 阶段开始时负载均衡器认为可用的服务器权重，不可用为 0
+	noServer int64
+}
+
+// runStats 一次模拟运行的统计数据
+type runStats struct {
+	servers   []*serverStats
+	phases    []*phaseStats
+	sim       []*simServer
+	latencies []time.Duration
+	requests  int64
+	noServer  int64
+
+	lastServer int // 上一次选中的服务器
+	run        int // 上一次选中的服务器当前连续被选中次数
+
+	window       int     // 窗口大小（请求数）
+	windowCount  []int64 // 当前窗口内各服务器被选中次数
+	windowFilled int     // 当前窗口内请求数
+	windows      int     // 已完成的窗口数
+}
+
+func newRunStats(servers []*simServer, window int) *runStats {
+	rs := &runStats{
+		servers:     make([]*serverStats, len(servers)),
+		sim:         servers,
+		latencies:   make([]time.Duration, 0),
+		lastServer:  -1,
+		window:      window,
+		windowCount: make([]int64, len(servers)),
+	}
+	for i, ss := range servers {
+		rs.servers[i] = &serverStats{addr: ss.srv.Addr(), weight: ss.spec.weight, active: make([]int32, 0)}
+	}
+	rs.newPhase(0, "start")
+	return rs
+}
+
+// newPhase 开始一个新的统计阶段，记录此时负载均衡器认为可用的服务器权重
+func (rs *runStats) newPhase(at time.Duration, label string) {
+	p := &phaseStats{
+		start:    at,
+		label:    label,
+		selected: make([]int64, len(rs.servers)),
+		weights:  make([]int32, len(rs.servers)),
+	}
+	for i, ss := range rs.sim {
+		if !ss.removed && ss.srv.Available() {
+			p.weights[i] = ss.spec.weight
+		}
+	}
+	rs.phases = append(rs.phases, p)
+}
+
+func (rs *runStats) currentPhase() *phaseStats {
+	return rs.phases[len(rs.phases)-1]
+}
+
+func (rs *runStats) recordNoServer() {
+	rs.requests++
+	rs.noServer++
+	rs.currentPhase().noServer++
+}
+
+// recordSelect 记录一次选择，service 小于 0 表示请求失败
+func (rs *runStats) recordSelect(idx int, active int32, service time.Duration) {
+	rs.requests++
+	s := rs.servers[idx]
+	s.selected++
+	s.active = append(s.active, active)
+	rs.currentPhase().selected[idx]++
+	if service < 0 {
+		s.errors++
+	} else {
+		rs.latencies = append(rs.latencies, service)
+	}
+
+	if idx == rs.lastServer {
+		rs.run++
+	} else {
+		rs.lastServer, rs.run = idx, 1
+	}
+	if rs.run > s.maxRun {
+		s.maxRun = rs.run
+	}
+
+	rs.windowCount[idx]++
+	rs.windowFilled++
+	if rs.windowFilled == rs.window {
+		rs.closeWindow()
+	}
+}
+
+// closeWindow 结束当前窗口，累加各服务器在窗口内被选中次数的和与平方和
+func (rs *runStats) closeWindow() {
+	for i, c := range rs.windowCount {
+		rs.servers[i].windowSum += float64(c)
+		rs.servers[i].windowSqSum += float64(c) * float64(c)
+		rs.windowCount[i] = 0
+	}
+	rs.windowFilled = 0
+	rs.windows++
+}
+
+// finish 结束统计，不足一个窗口的尾部请求不参与突发度计算
+func (rs *runStats) finish() {
+	sort.Slice(rs.latencies, func(i, j int) bool {
+		return rs.latencies[i] < rs.latencies[j]
+	})
+	for _, s := range rs.servers {
+		sort.Slice(s.active, func(i, j int) bool {
+			return s.active[i] < s.active[j]
+		})
+	}
+}
+
+// dispersion 窗口内被选中次数的离散指数（方差/均值），越接近 0 分布越平滑，独立随机选择约为 1 - 份额
+func (s *serverStats) dispersion(windows int) float64 {
+	if windows == 0 || s.windowSum == 0 {
+		return 0
+	}
+	mean := s.windowSum / float64(windows)
+	variance := s.windowSqSum/float64(windows) - mean*mean
+	return variance / mean
+}
+
+func percentileActive(sorted []int32, p float64) int32 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func percentileLatency(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func percent(part, total float64) string {
+	if total == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(part/total*100, 'f', 1, 64) + "%"
+}
+
+// print 输出模拟报告
+func (rs *runStats) print(w io.Writer, title string) {
+	fmt.Fprintf(w, "==== %s ====\n", title)
+	var errors int64
+	var selected, totalWeight float64
+	for _, s := range rs.servers {
+		errors += s.errors
+		selected += float64(s.selected)
+		totalWeight += float64(s.weight)
+	}
+	fmt.Fprintf(w, "requests: %d  no server: %d  failed: %d  latency p50/p99/max: %v/%v/%v\n",
+		rs.requests, rs.noServer, errors,
+		percentileLatency(rs.latencies, 0.5), percentileLatency(rs.latencies, 0.99), percentileLatency(rs.latencies, 1))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "server\tweight\tshare\texpected\tratio\tmax run\tdispersion\tactive p50/p99/max\tfailed")
+	for _, s := range rs.servers {
+		ratio := "-"
+		if selected > 0 && s.weight > 0 {
+			ratio = strconv.FormatFloat(float64(s.selected)/selected/(float64(s.weight)/totalWeight), 'f', 2, 64)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%d\t%.2f\t%d/%d/%d\t%d\n",
+			s.addr, s.weight, percent(float64(s.selected), selected), percent(float64(s.weight), totalWeight), ratio,
+			s.maxRun, s.dispersion(rs.windows),
+			percentileActive(s.active, 0.5), percentileActive(s.active, 0.99), percentileActive(s.active, 1), s.errors)
+	}
+	tw.Flush()
+
+	if len(rs.phases) > 1 {
+		fmt.Fprintln(w, "phases (share / expected share):")
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		header := []string{"from", "event", "no server"}
+		for _, s := range rs.servers {
+			header = append(header, s.addr)
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, p := range rs.phases {
+			var phaseSelected, phaseWeight float64
+			for i := range rs.servers {
+				phaseSelected += float64(p.selected[i])
+				phaseWeight += float64(p.weights[i])
+			}
+			row := []string{p.start.String(), p.label, strconv.FormatInt(p.noServer, 10)}
+			for i := range rs.servers {
+				row = append(row, percent(float64(p.selected[i]), phaseSelected)+" / "+percent(float64(p.weights[i]), phaseWeight))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errServerSpecInvalid = errors.New("invalid server spec, expect weight/latency[/capacity]")
+	errEventSpecInvalid  = errors.New("invalid event spec, expect index@time or index@time+duration")
+	errTraceLineInvalid  = errors.New("invalid trace line, expect offset [key]")
+)
+
+// serverSpec 模拟服务器参数
+type serverSpec struct {
+	weight   int32         // 权重
+	latency  time.Duration // 平均处理时间
+	capacity int           // 并发处理能力，活跃请求数超过该值后处理时间按比例增长，为 0 表示不限制
+}
+
+// parseServerSpecs 解析服务器参数列表
+// 格式：weight/latency[/capacity]，以逗号分隔，例如 100/10ms,100/10ms,200/20ms/8
+func parseServerSpecs(s string) ([]serverSpec, error) {
+	specs := make([]serverSpec, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		fields := strings.Split(item, "/")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, errServerSpecInvalid
+		}
+		weight, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			return nil, errServerSpecInvalid
+		}
+		latency, err := time.ParseDuration(fields[1])
+		if err != nil || latency <= 0 {
+			return nil, errServerSpecInvalid
+		}
+		spec := serverSpec{weight: int32(weight), latency: latency}
+		if len(fields) == 3 {
+			spec.capacity, err = strconv.Atoi(fields[2])
+			if err != nil || spec.capacity < 0 {
+				return nil, errServerSpecInvalid
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errServerSpecInvalid
+	}
+	return specs, nil
+}
+
+type scenarioKind int
+
+const (
+	scenarioFail    scenarioKind = iota // 服务器实际故障，请求失败但负载均衡器尚未感知
+	scenarioDetect                      // 健康检测发现故障，服务器被主观认为下线
+	scenarioRecover                     // 服务器实际恢复
+	scenarioOnline                      // 健康检测发现恢复，服务器恢复上线
+	scenarioRemove                      // 从负载均衡器中删除服务器
+)
+
+func (k scenarioKind) String() string {
+	switch k {
+	case scenarioFail:
+		return "fail"
+	case scenarioDetect:
+		return "pfail"
+	case scenarioRecover:
+		return "recover"
+	case scenarioOnline:
+		return "online"
+	case scenarioRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// scenarioEvent 运行期间发生的服务器故障、恢复或删除
+type scenarioEvent struct {
+	at     time.Duration
+	kind   scenarioKind
+	server int
+}
+
+// parseEventSpec 解析 index@time[+duration]
+func parseEventSpec(item string, serverNum int) (idx int, at time.Duration, dur time.Duration, err error) {
+	parts := strings.SplitN(item, "@", 2)
+	if len(parts) != 2 {
+		return 0, 0, 0, errEventSpecInvalid
+	}
+	idx, err = strconv.Atoi(parts[0])
+	if err != nil || idx < 0 || idx >= serverNum {
+		return 0, 0, 0, errEventSpecInvalid
+	}
+	timeParts := strings.SplitN(parts[1], "+", 2)
+	at, err = time.ParseDuration(timeParts[0])
+	if err != nil || at < 0 {
+		return 0, 0, 0, errEventSpecInvalid
+	}
+	if len(timeParts) == 2 {
+		dur, err = time.ParseDuration(timeParts[1])
+		if err != nil || dur <= 0 {
+			return 0, 0, 0, errEventSpecInvalid
+		}
+	}
+	return idx, at, dur, nil
+}
+
+// parseScenario 解析故障与删除事件
+// fails：index@time+duration，服务器 index 在 time 时刻故障，持续 duration（省略则不恢复），
+// 负载均衡器在故障或恢复 detect 时长之后才感知；removes：index@time，在 time 时刻删除服务器 index
+func parseScenario(fails, removes string, detect time.Duration, serverNum int) ([]scenarioEvent, error) {
+	events := make([]scenarioEvent, 0)
+	for _, item := range strings.Split(fails, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx, at, dur, err := parseEventSpec(item, serverNum)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events,
+			scenarioEvent{at: at, kind: scenarioFail, server: idx},
+			scenarioEvent{at: at + detect, kind: scenarioDetect, server: idx})
+		if dur > 0 {
+			events = append(events,
+				scenarioEvent{at: at + dur, kind: scenarioRecover, server: idx},
+				scenarioEvent{at: at + dur + detect, kind: scenarioOnline, server: idx})
+		}
+	}
+	for _, item := range strings.Split(removes, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx, at, _, err := parseEventSpec(item, serverNum)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, scenarioEvent{at: at, kind: scenarioRemove, server: idx})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].at < events[j].at
+	})
+	return events, nil
+}
+
+// traceEntry 请求轨迹中的一个请求
+type traceEntry struct {
+	at  time.Duration // 到达时间（相对开始时间）
+	key string        // 哈希键，哈希类负载均衡器使用
+}
+
+// generateTrace 生成泊松到达的合成请求轨迹，哈希键从 keyNum 个键中均匀选取
+func generateTrace(requests int, rate float64, keyNum int, rnd *rand.Rand) []traceEntry {
+	trace := make([]traceEntry, requests)
+	var at float64
+	for i := range trace {
+		at += rnd.ExpFloat64() / rate
+		trace[i].at = time.Duration(at * float64(time.Second))
+		if keyNum > 0 {
+			trace[i].key = "key-" + strconv.Itoa(rnd.Intn(keyNum))
+		}
+	}
+	return trace
+}
+
+// loadTrace 读取记录的请求轨迹文件
+// 每行格式：offset [key]，offset 为相对开始时间的时长（如 15ms），# 开头的行为注释
+func loadTrace(path string) ([]traceEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	trace := make([]traceEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		at, err := time.ParseDuration(fields[0])
+		if err != nil || len(fields) > 2 {
+			return nil, errTraceLineInvalid
+		}
+		entry := traceEntry{at: at}
+		if len(fields) == 2 {
+			entry.key = fields[1]
+		}
+		trace = append(trace, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(trace, func(i, j int) bool {
+		return trace[i].at < trace[j].at
+	})
+	return trace, nil
+}
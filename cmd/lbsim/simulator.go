@@ -0,0 +1,201 @@
+package main
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb"
+	"container/heap"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	distExp   = "exp"   // 处理时间服从指数分布
+	distConst = "const" // 处理时间固定
+)
+
+// simServer 模拟服务器
+type simServer struct {
+	srv     *server.Server
+	spec    serverSpec
+	failed  bool // 是否实际故障（负载均衡器可能尚未感知）
+	removed bool // 是否已从负载均衡器中删除
+}
+
+// completion 请求完成事件
+type completion struct {
+	at      time.Duration
+	server  int
+	service time.Duration
+}
+
+// completionHeap 按完成时间排序的小顶堆
+type completionHeap []completion
+
+func (h completionHeap) Len() int           { return len(h) }
+func (h completionHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h completionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *completionHeap) Push(x any) {
+	*h = append(*h, x.(completion))
+}
+
+func (h *completionHeap) Pop() any {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+	return c
+}
+
+// simulator 离散事件模拟器
+// 请求按轨迹中的时间到达，由负载均衡器选择服务器后按服务器的处理时间完成，模拟时间与真实时间无关，
+// 因此依赖真实时间的特性（慢启动、Peak EWMA 的时间衰减）在模拟中不能准确体现
+type simulator struct {
+	servers     []*simServer
+	serverIndex map[*server.Server]int
+	lb          slb.LoadBalancer
+	keyedLB     slb.KeyedLoadBalancer
+	rnd         *rand.Rand
+	dist        string
+	completions completionHeap
+	stats       *runStats
+}
+
+// newSimulator 使用 balancerType 类型的负载均衡器创建模拟器，每次创建都使用新的服务器实例
+func newSimulator(balancerType slb.LoadBalancerType, specs []serverSpec, dist string, window int, seed int64) (*simulator, error) {
+	lb, err := slb.LoadBalancerFactory(balancerType, nil)
+	if err != nil {
+		return nil, err
+	}
+	sim := &simulator{
+		servers:     make([]*simServer, 0, len(specs)),
+		serverIndex: make(map[*server.Server]int, len(specs)),
+		lb:          lb,
+		rnd:         rand.New(rand.NewSource(seed)),
+		dist:        dist,
+		completions: make(completionHeap, 0),
+	}
+	if keyedLB, ok := lb.(slb.KeyedLoadBalancer); ok {
+		sim.keyedLB = keyedLB
+	}
+	serverList := make([]*server.Server, 0, len(specs))
+	for i, spec := range specs {
+		s, err := server.NewServer("10.0.0."+strconv.Itoa(i+1)+":80", spec.weight, server.NoHealthCheck)
+		if err != nil {
+			return nil, err
+		}
+		sim.servers = append(sim.servers, &simServer{srv: s, spec: spec})
+		sim.serverIndex[s] = i
+		serverList = append(serverList, s)
+	}
+	err = lb.InitServerNode(serverList)
+	if err != nil {
+		return nil, err
+	}
+	sim.stats = newRunStats(sim.servers, window)
+	return sim, nil
+}
+
+// run 回放请求轨迹，并在指定时刻执行故障、恢复与删除事件
+// 同一时刻先处理请求完成，再处理场景事件，最后处理请求到达
+func (sim *simulator) run(trace []traceEntry, events []scenarioEvent) *runStats {
+	i, j := 0, 0
+	for i < len(trace) || j < len(events) || sim.completions.Len() > 0 {
+		next := time.Duration(1<<63 - 1)
+		if sim.completions.Len() > 0 {
+			next = sim.completions[0].at
+		}
+		if j < len(events) && events[j].at < next {
+			next = events[j].at
+		}
+		if i < len(trace) && trace[i].at < next {
+			next = trace[i].at
+		}
+
+		switch {
+		case sim.completions.Len() > 0 && sim.completions[0].at == next:
+			c := heap.Pop(&sim.completions).(completion)
+			s := sim.servers[c.server].srv
+			s.DecrActiveReq()
+			s.RecordLatency(c.service)
+		case j < len(events) && events[j].at == next:
+			sim.apply(events[j])
+			j++
+		default:
+			sim.dispatch(trace[i])
+			i++
+		}
+	}
+	sim.stats.finish()
+	return sim.stats
+}
+
+// apply 执行场景事件，并开始新的统计阶段
+func (sim *simulator) apply(e scenarioEvent) {
+	ss := sim.servers[e.server]
+	switch e.kind {
+	case scenarioFail:
+		ss.failed = true
+	case scenarioRecover:
+		ss.failed = false
+	case scenarioDetect, scenarioOnline:
+		if ss.removed {
+			return
+		}
+		if e.kind == scenarioDetect {
+			ss.srv.SetPfail(server.IS_PFAIL)
+		} else {
+			ss.srv.SetPfail(server.NOT_PFAIL)
+		}
+		sim.lb.OnServerUpdate(ss.srv, server.PfailChanged)
+	case scenarioRemove:
+		if ss.removed {
+			return
+		}
+		if sim.lb.DeleteServerNode(ss.srv) == nil {
+			ss.removed = true
+		}
+	}
+	sim.stats.newPhase(e.at, "server"+strconv.Itoa(e.server)+" "+e.kind.String())
+}
+
+// dispatch 使用负载均衡器为请求选择服务器，发送到实际故障服务器的请求直接失败
+func (sim *simulator) dispatch(entry traceEntry) {
+	var s *server.Server
+	var err error
+	if sim.keyedLB != nil && entry.key != "" {
+		s, err = sim.keyedLB.SelectNodeByKey(entry.key)
+	} else {
+		s, err = sim.lb.SelectNode()
+	}
+	if err != nil {
+		sim.stats.recordNoServer()
+		return
+	}
+	idx := sim.serverIndex[s]
+	ss := sim.servers[idx]
+	if ss.failed {
+		sim.stats.recordSelect(idx, s.ActiveReq(), -1)
+		return
+	}
+	service := sim.serviceTime(ss)
+	sim.stats.recordSelect(idx, s.ActiveReq(), service)
+	s.IncrActiveReq()
+	heap.Push(&sim.completions, completion{at: entry.at + service, server: idx, service: service})
+}
+
+// serviceTime 计算请求的处理时间，活跃请求数超过服务器的并发处理能力后处理时间按比例增长
+func (sim *simulator) serviceTime(ss *simServer) time.Duration {
+	service := float64(ss.spec.latency)
+	if sim.dist == distExp {
+		service *= sim.rnd.ExpFloat64()
+	}
+	if ss.spec.capacity > 0 {
+		active := float64(ss.srv.ActiveReq() + 1)
+		if load := active / float64(ss.spec.capacity); load > 1 {
+			service *= load
+		}
+	}
+	return time.Duration(service)
+}
@@ -1,12 +1,15 @@
 package config
 
 import (
+	"EH-Proxy/pkg/server"
 	"EH-Proxy/pkg/slb"
 	"EH-Proxy/pkg/system/sysPrint"
-	"EH-Proxy/pkg/utils/datastructure"
+	"crypto/rand"
+	"encoding/hex"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -23,6 +26,32 @@ const (
 	defaultUrlPathCheck        = false
 	defaultLoadBalancerType    = slb.RoundRobin
 	defaultKeepAliveOption     = false
+	defaultHashKey             = "ip"
+	DefaultStickyCookieName    = "EHPROXY_STICKY"
+	defaultStickyTTL           = 24 * time.Hour
+	stickySecretLength         = 32
+	DefaultRetryAfter          = 1 * time.Second
+	DefaultGroupName           = "default" // 顶层 load-balancer-type 与 server-list 组成的默认服务器组名称
+	DefaultMirrorConcurrency   = 100
+	DefaultMirrorMaxBodySize   = 1 << 20
+	DefaultMirrorTimeout       = 3 * time.Second
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryMaxBodySize    = 1 << 20
+	UrlPathCheckAllow          = "allow" // URL 路径检测的允许名单模式
+	UrlPathCheckDeny           = "deny"  // URL 路径检测的拒绝名单模式
+)
+
+// 被动异常检测的默认值
+const (
+	DefaultOutlierConsecutiveErrors = 5
+	DefaultOutlierInterval          = 10 * time.Second
+	DefaultOutlierErrorRateFactor   = 2.0
+	DefaultOutlierMinErrorRate      = 0.1
+	DefaultOutlierMinRequests       = 20
+	DefaultOutlierMinServers        = 3
+	DefaultBaseEjectionTime         = 30 * time.Second
+	DefaultMaxEjectionTime          = 300 * time.Second
+	DefaultMaxEjectionPercent       = 10
 )
 
 var (
@@ -32,8 +61,8 @@ var (
 type ProxyConfig struct {
 	Addr                 string        `yaml:"proxy-addr"`             // proxy 连接地址
 	ManagerAddr          string        `yaml:"proxy-manager-addr"`     // proxy manager 连接地址
-	CircuitBreakerOption bool          `yaml:"circuit-breaker-option"` // 熔断机制/断路器开关
-	RequestTimeout       time.Duration `yaml:"request-timeout"`        // 请求超时时间（开启断路器后有效）
+	CircuitBreakerOption bool          `yaml:"circuit-breaker-option"` // 熔断机制/断路器开关，配置见 circuit-breaker
+	RequestTimeout       time.Duration `yaml:"request-timeout"`        // 请求超时时间（开启断路器后有效），超时计为失败
 	HealthCheckOption    bool          `yaml:"health-check-option"`    // 健康检测开关
 	HeahthCheckInterval  time.Duration `yaml:"heahth-check-interval"`  // 每次健康检测间隔
 	PfailTime            time.Duration `yaml:"pfail-time"`             // 认为下线需要的未响应时间
@@ -41,17 +70,242 @@ type ProxyConfig struct {
 	// proxy 和 server 之间的连接是否使用 keepAlive，
 	// 默认关闭，请确保调整系统与进程最大打开文件数足够大后再在 config.yaml 中设为 true
 	KeepAliveOption    bool                 `yaml:"keep-alive-option"`
-	LoadBalancerType   slb.LoadBalancerType `yaml:"load-balancer-type"`     // 负载均衡器类型
-	UrlPathCheckOption bool                 `yaml:"url-path-check-option"`  // URL 路径匹配开关
-	UrlPathMap         map[string]struct{}  `yaml:"url-path-map,omitempty"` // URL 路径完全匹配哈希表
-	UrlPathTrie        *datastructure.Trie  `yaml:"-"`                      // URL 路径前缀树，用于前缀匹配
-	InitServerList     []ServerConfig       `yaml:"server-list,omitempty"`  // 初始化服务器列表
+	LoadBalancerType   slb.LoadBalancerType `yaml:"load-balancer-type"`    // 负载均衡器类型
+	UrlPathCheckOption bool                 `yaml:"url-path-check-option"` // URL 路径匹配开关
+	InitServerList     []ServerConfig       `yaml:"server-list,omitempty"` // 初始化服务器列表
+
+	// URL 路径检测模式：allow 为允许名单，只转发匹配 url-path-map 的请求；deny 为拒绝名单，拒绝匹配 url-path-map 的请求，
+	// 其余请求正常转发。为空时为 allow
+	UrlPathCheckMode string `yaml:"url-path-check-mode,omitempty"`
+
+	// URL 路径检测拒绝请求时的默认响应，未设置状态码时返回 400 "Invalid URL path."
+	UrlPathCheckResponse UrlPathResponseConfig `yaml:"url-path-check-response,omitempty"`
+
+	// URL 路径表，key 为 datastructure.RadixTree 的路径模式，如 /users/:id、/users/:id<[0-9]+>、/static/**，
+	// 以 * 结尾的路径（如 /api* 或 /api/*）按路径段进行前缀匹配，即匹配 /api 与 /api/ 下的所有路径，但不匹配 /apiary
+	// value 为该路径的拒绝响应，为空时使用 url-path-check-response。allow 模式下设置了响应的路径也会被拒绝，
+	// 可用于在允许的路径下排除更具体的路径，例如：
+	// url-path-map:
+	//   /api*:
+	//   /api/internal*: {status: 404}
+	// 运行时可通过 AddPath / DeletePath 命令修改，执行 Save 命令保存
+	UrlPathMap map[string]*UrlPathResponseConfig `yaml:"url-path-map,omitempty"`
+
+	// 哈希类负载均衡器（如 consistent-hash）使用的请求哈希键：
+	// ip 为客户端 IP，header:<name> 为指定请求头，cookie:<name> 为指定 cookie，取不到值时使用客户端 IP
+	HashKey string `yaml:"hash-key"`
+
+	// 各类型负载均衡器的选项，key 为负载均衡器类型，例如：
+	// load-balancer-options:
+	//   consistent-hash:
+	//     virtual-nodes: 160
+	LoadBalancerOptions map[slb.LoadBalancerType]map[string]any `yaml:"load-balancer-options,omitempty"`
+
+	// 全局慢启动时长，服务器新加入或恢复上线后，负载均衡器使用的有效权重在该时长内从较小值线性增长到权重，
+	// 为 0 则不进行慢启动，可在 server-list 中为单个服务器单独设置
+	SlowStart time.Duration `yaml:"slow-start,omitempty"`
+
+	StickySession StickySessionConfig `yaml:"sticky-session"` // 基于 cookie 的会话保持
+
+	ConcurrencyLimit ConcurrencyLimitConfig `yaml:"concurrency-limit"` // 服务器自适应并发限制
+
+	// 除默认服务器组（顶层 load-balancer-type 与 server-list）以外的服务器组，每组有独立的负载均衡器与服务器列表
+	ServerGroups []ServerGroupConfig `yaml:"server-groups,omitempty"`
+
+	// 路由表，根据请求的 Host 与路径前缀选择服务器组，未匹配任何路由的请求转发给默认服务器组
+	Routes []RouteConfig `yaml:"routes,omitempty"`
+
+	Mirror MirrorOptionConfig `yaml:"mirror"` // 请求镜像的全局选项，镜像的服务器组与比例在路由中配置
+	Retry  RetryConfig        `yaml:"retry"`  // 请求失败时的重试配置
+
+	// 断路器配置（开启 circuit-breaker-option 后有效），每个服务器使用独立的断路器
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit-breaker"`
+
+	// 被动异常检测配置，根据实际转发请求的结果驱逐异常的服务器，对每个服务器组分别生效
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier-detection"`
+}
+
+// MirrorOptionConfig 请求镜像的全局选项，值为 0 时使用默认值
+type MirrorOptionConfig struct {
+	MaxConcurrency int           `yaml:"max-concurrency"` // 同时进行的镜像请求数上限，达到上限时不再镜像新的请求
+	MaxBodySize    int64         `yaml:"max-body-size"`   // 镜像请求的请求体大小上限（字节），请求体超过上限的请求不会被镜像
+	Timeout        time.Duration `yaml:"timeout"`         // 镜像请求的超时时间
+}
+
+// CircuitBreakerConfig 服务器断路器配置
+// 连接错误、请求超时与 5xx 响应计为失败。关闭状态下连续失败次数或时间窗口内的失败率达到阈值时打开断路器，服务器不再被选择；
+// 打开 open-duration 后进入半开状态，放行 half-open-requests 个试探请求，全部成功则关闭，任意一个失败则重新打开。值为 0 时使用默认值
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int32         `yaml:"consecutive-failures"` // 连续失败次数阈值，与 failure-rate 都为 0 时默认为 5
+	FailureRate         float64       `yaml:"failure-rate"`         // 失败率阈值（0~1），为 0 时不按失败率打开
+	MinRequests         int32         `yaml:"min-requests"`         // 时间窗口内的请求数达到该值后才计算失败率
+	Window              time.Duration `yaml:"window"`               // 统计失败率的时间窗口
+	OpenDuration        time.Duration `yaml:"open-duration"`        // 断路器打开的持续时长
+	HalfOpenRequests    int32         `yaml:"half-open-requests"`   // 半开状态放行的试探请求数
+}
+
+// BreakerOptions 转换为服务器断路器选项
+func (c CircuitBreakerConfig) BreakerOptions() server.BreakerOptions {
+	return server.BreakerOptions{
+		ConsecutiveFailures: c.ConsecutiveFailures,
+		FailureRate:         c.FailureRate,
+		MinRequests:         c.MinRequests,
+		Window:              c.Window,
+		OpenDuration:        c.OpenDuration,
+		HalfOpenRequests:    c.HalfOpenRequests,
+	}
+}
+
+// OutlierDetectionConfig 被动异常检测配置
+// 连接错误、请求超时与 5xx 响应计为错误。服务器连续错误次数达到 consecutive-errors，或每个检测周期内错误率不低于 min-error-rate
+// 且超过组内平均错误率的 error-rate-factor 倍时被驱逐，驱逐时长为 base-ejection-time * 2^(连续驱逐次数-1)，不超过 max-ejection-time；
+// 服务器在未被驱逐的检测周期中逐次减少连续驱逐次数。组内同时被驱逐的服务器不超过 max-ejection-percent（至少可驱逐 1 个），组内最后一个可用的服务器不会被驱逐。值为 0 时使用默认值
+type OutlierDetectionConfig struct {
+	Enable             bool          `yaml:"enable"`               // 异常检测开关
+	ConsecutiveErrors  int32         `yaml:"consecutive-errors"`   // 连续错误次数阈值
+	Interval           time.Duration `yaml:"interval"`             // 检测周期，每个周期按错误率检测一次并重置统计
+	ErrorRateFactor    float64       `yaml:"error-rate-factor"`    // 错误率超过组内平均错误率的倍数
+	MinErrorRate       float64       `yaml:"min-error-rate"`       // 按错误率驱逐的最低错误率（0~1）
+	MinRequests        int32         `yaml:"min-requests"`         // 周期内请求数达到该值的服务器才参与错误率检测
+	MinServers         int32         `yaml:"min-servers"`          // 参与错误率检测的服务器数达到该值才按错误率驱逐
+	BaseEjectionTime   time.Duration `yaml:"base-ejection-time"`   // 基础驱逐时长
+	MaxEjectionTime    time.Duration `yaml:"max-ejection-time"`    // 最大驱逐时长
+	MaxEjectionPercent int32         `yaml:"max-ejection-percent"` // 组内同时被驱逐的服务器比例上限（百分比）
+}
+
+// RetryConfig 请求重试配置
+// 开启后连接服务器失败、单次尝试超时或响应状态码在 status-codes 中时，使用负载均衡器选择另一个未尝试过的服务器重试，
+// 只重试 methods 中的请求方法，请求体超过 max-body-size 的请求不重试。值为 0 或为空时使用默认值
+type RetryConfig struct {
+	Enable        bool          `yaml:"enable"`                 // 重试开关
+	MaxAttempts   int           `yaml:"max-attempts"`           // 最大尝试次数（包括首次请求）
+	PerTryTimeout time.Duration `yaml:"per-try-timeout"`        // 每次尝试的超时时间，为 0 时不限制
+	StatusCodes   []int         `yaml:"status-codes,omitempty"` // 需要重试的响应状态码，默认为 502、503、504
+	Methods       []string      `yaml:"methods,omitempty"`      // 可以重试的请求方法，默认为幂等方法 GET、HEAD、OPTIONS、PUT、DELETE、TRACE
+	MaxBodySize   int64         `yaml:"max-body-size"`          // 可重试请求的请求体大小上限（字节），重试需要将请求体保存在内存中
+}
+
+// UrlPathResponseConfig URL 路径检测拒绝请求时的响应
+// 设置了 Location 时为重定向，状态码需为 3xx，未设置状态码时为 302
+type UrlPathResponseConfig struct {
+	Status   int    `yaml:"status,omitempty"`   // 响应状态码，如 403、404
+	Body     string `yaml:"body,omitempty"`     // 响应体，为空时使用状态码对应的描述
+	Location string `yaml:"location,omitempty"` // 重定向地址
+}
+
+// ServerGroupConfig 服务器组配置
+type ServerGroupConfig struct {
+	Name             string               `yaml:"name"`                         // 服务器组名称
+	LoadBalancerType slb.LoadBalancerType `yaml:"load-balancer-type,omitempty"` // 负载均衡器类型，为空时使用顶层 load-balancer-type
+	ServerList       []ServerConfig       `yaml:"server-list,omitempty"`        // 服务器列表
+}
+
+// RouteConfig 路由规则，请求需满足规则中的所有条件
+// 多条路由同时匹配时，Host 完全匹配优先于通配符匹配，通配符匹配优先于不限 Host，Host 相同时条件（请求方法、请求头、查询参数）
+// 较多者优先，其次路径前缀与路径模式较长者优先，仍然相同时按配置顺序选择
+type RouteConfig struct {
+	Name       string        `yaml:"name,omitempty"`        // 路由名称，管理命令（如 SetSplit）通过名称指定路由
+	Host       string        `yaml:"host,omitempty"`        // 匹配 Host 请求头（忽略端口与大小写），支持 *.example.com 形式的通配符，为空时匹配任意 Host
+	PathPrefix string        `yaml:"path-prefix,omitempty"` // 匹配的路径前缀（按路径段匹配，/api 不匹配 /apiary），为空时匹配任意路径
+	Path       string        `yaml:"path,omitempty"`        // 按路径段匹配的路径模式，如 /users/:id、/static/**，语法同 url-path-map，为空时匹配任意路径
+	Methods    []string      `yaml:"methods,omitempty"`     // 匹配的请求方法（忽略大小写），满足其一即可，为空时匹配任意方法
+	Headers    []MatchConfig `yaml:"headers,omitempty"`     // 请求头匹配条件，需全部满足
+	Query      []MatchConfig `yaml:"query,omitempty"`       // 查询参数匹配条件，需全部满足
+	Group      string        `yaml:"group,omitempty"`       // 转发的服务器组名称，设置 split 时忽略
+	Split      *SplitConfig  `yaml:"split,omitempty"`       // 按权重在多个服务器组之间分流
+	Mirror     *MirrorConfig `yaml:"mirror,omitempty"`      // 将部分请求镜像到影子服务器组
+	Rewrite    RewriteConfig `yaml:"rewrite,omitempty"`     // 转发前对请求路径与 Host 的改写
+}
+
+// SplitConfig 流量分流配置，用于灰度发布等场景
+// 根据分流键的哈希值将请求按权重分配到各服务器组，同一个分流键总是分配到同一个服务器组；
+// 调整权重时按配置顺序划分区间，例如 stable:95 canary:5 调整为 stable:90 canary:10 后，原来分配到 canary 的请求仍然分配到 canary
+type SplitConfig struct {
+	Groups []SplitGroupConfig `yaml:"groups"`        // 分流的服务器组与权重
+	Key    string             `yaml:"key,omitempty"` // 分流键来源，格式同 hash-key（ip / header:<name> / cookie:<name>），为空时使用 hash-key
+
+	// 强制指定服务器组的请求头或 cookie（header:<name> / cookie:<name>），
+	// 请求携带的值为 groups 中的服务器组名称时直接转发给该服务器组，为空时不允许强制指定
+	Override string `yaml:"override,omitempty"`
+}
+
+// MirrorConfig 请求镜像配置
+// 按比例将请求复制一份，在后台经过与正常请求相同的改写后发送给影子服务器组，影子服务器组的响应会被丢弃，不影响客户端的响应与延迟
+type MirrorConfig struct {
+	Group   string  `yaml:"group"`   // 影子服务器组名称
+	Percent float64 `yaml:"percent"` // 镜像的请求比例（0~100）
+}
+
+// SplitGroupConfig 分流的服务器组与权重
+type SplitGroupConfig struct {
+	Group  string `yaml:"group"`
+	Weight int32  `yaml:"weight"`
+}
+
+// RewriteConfig 请求改写规则，路径依次经过去除前缀、正则替换、添加前缀三个步骤，均作用于转义后的路径（如 %2F 不会被解码为 /）
+type RewriteConfig struct {
+	StripPrefix  string `yaml:"strip-prefix,omitempty"`  // 去除的路径前缀（按路径段匹配），如 /api/v1 将 /api/v1/users 改写为 /users，不改写 /api/v1users
+	Regex        string `yaml:"regex,omitempty"`         // 路径正则替换的正则表达式（RE2 语法），替换所有匹配的部分
+	Replacement  string `yaml:"replacement,omitempty"`   // 正则替换的内容，支持 $1、${name} 形式引用捕获组
+	AddPrefix    string `yaml:"add-prefix,omitempty"`    // 添加的路径前缀
+	Host         string `yaml:"host,omitempty"`          // 覆盖转发请求的 Host 请求头
+	UpstreamHost bool   `yaml:"upstream-host,omitempty"` // 使用服务器地址作为 Host 请求头，Host 与 UpstreamHost 都未设置时保留客户端的 Host
+}
+
+// MatchConfig 请求头或查询参数匹配条件
+// Exact、Prefix、Regex 至多填写一个，都为空时只要求请求中存在该请求头或查询参数；存在多个同名值时任意一个满足即可
+type MatchConfig struct {
+	Name   string `yaml:"name"`             // 请求头或查询参数名称，请求头名称忽略大小写
+	Exact  string `yaml:"exact,omitempty"`  // 完全匹配
+	Prefix string `yaml:"prefix,omitempty"` // 前缀匹配
+	Regex  string `yaml:"regex,omitempty"`  // 正则表达式匹配（RE2 语法，部分匹配，需要完全匹配时加上 ^ 与 $）
+}
+
+// StickySessionConfig 会话保持配置
+// 开启后 proxy 在首次请求的响应中设置 cookie 记录所选服务器，之后携带该 cookie 的请求直接转发给该服务器，
+// 服务器被删除或主观下线时回退到负载均衡器选择。cookie 值为服务器地址的 HMAC，不会暴露服务器地址
+type StickySessionConfig struct {
+	Enable     bool          `yaml:"enable"`           // 会话保持开关
+	CookieName string        `yaml:"cookie-name"`      // cookie 名称
+	TTL        time.Duration `yaml:"ttl"`              // cookie 有效期，为 0 时为会话 cookie
+	Secure     bool          `yaml:"secure"`           // 是否设置 cookie 的 Secure 属性
+	Secret     string        `yaml:"secret,omitempty"` // 计算 cookie 值使用的 HMAC 密钥，为空时每次启动随机生成
+}
+
+// ConcurrencyLimitConfig 服务器自适应并发限制配置
+// 开启后每个服务器根据观测到的响应延迟使用 AIMD 算法调整并发限制，活跃请求数达到限制的服务器不再被选中，
+// 所有服务器都达到限制时 proxy 返回 503 并通过 Retry-After 响应头告知客户端重试时间。值为 0 时使用默认值
+type ConcurrencyLimitConfig struct {
+	Enable       bool          `yaml:"enable"`        // 并发限制开关
+	InitialLimit int32         `yaml:"initial-limit"` // 初始并发限制
+	MinLimit     int32         `yaml:"min-limit"`     // 最小并发限制
+	MaxLimit     int32         `yaml:"max-limit"`     // 最大并发限制
+	Tolerance    float64       `yaml:"tolerance"`     // 响应延迟超过 最小延迟 * tolerance 时认为服务器过载
+	Backoff      float64       `yaml:"backoff"`       // 过载时并发限制乘以该比例
+	RetryAfter   time.Duration `yaml:"retry-after"`   // 返回 503 时建议客户端的重试间隔
+}
+
+// LimiterOptions 转换为服务器并发限制器选项
+func (c ConcurrencyLimitConfig) LimiterOptions() server.LimiterOptions {
+	return server.LimiterOptions{
+		InitialLimit: c.InitialLimit,
+		MinLimit:     c.MinLimit,
+		MaxLimit:     c.MaxLimit,
+		Tolerance:    c.Tolerance,
+		Backoff:      c.Backoff,
+	}
 }
 
 type ServerConfig struct {
-	Addr   string `yaml:"addr"`   // 服务器连接地址（IP:PORT）
-	Weight int32  `yaml:"weight"` // 权重
-	Probe  string `yaml:"probe"`  // 健康监测请求地址，需要加上 HTTP Scheme(http://)
+	Addr      string        `yaml:"addr"`                 // 服务器连接地址（IP:PORT）
+	Weight    int32         `yaml:"weight"`               // 权重
+	Probe     string        `yaml:"probe"`                // 健康监测请求地址，需要加上 HTTP Scheme(http://)
+	SlowStart time.Duration `yaml:"slow-start,omitempty"` // 慢启动时长，为 0 时使用全局 slow-start
+
+	// 优先级，数值越小优先级越高，默认为 0，只有当更高优先级的服务器全部下线或排空时才会选择较低优先级的服务器；
+	// backup 为 true 时为备用服务器，优先级低于所有普通服务器，此时忽略 priority
+	Priority int32 `yaml:"priority,omitempty"`
+	Backup   bool  `yaml:"backup,omitempty"`
 }
 
 func init() {
@@ -95,15 +349,26 @@ func NewProxyConfig() (*ProxyConfig, error) {
 		if err != nil {
 			return nil, err
 		}
-		for path := range pc.UrlPathMap {
-			if strings.HasSuffix(path, "*") {
-				pc.UrlPathTrie.Insert(path)
-			}
-		}
 		return pc, nil
 	}
 }
 
+// UrlPathPatterns 将 url-path-map 中的路径转换为 datastructure.RadixTree 的路径模式
+// 以 * 结尾的路径按路径段进行前缀匹配：/api/* 转换为 /api/**，/api* 转换为 /api 与 /api/**
+func UrlPathPatterns(path string) []string {
+	switch {
+	case strings.HasSuffix(path, "**"):
+		return []string{path}
+	case strings.HasSuffix(path, "/*"):
+		return []string{path + "*"}
+	case strings.HasSuffix(path, "*"):
+		prefix := strings.TrimSuffix(path, "*")
+		return []string{prefix, prefix + "/**"}
+	default:
+		return []string{path}
+	}
+}
+
 func createDefaultConfig(file *os.File) (*ProxyConfig, error) {
 	pc := &ProxyConfig{
 		Addr:                 defaultAddr,
@@ -115,10 +380,55 @@ func createDefaultConfig(file *os.File) (*ProxyConfig, error) {
 		PfailTime:            defaultPfailTime,
 		UrlPathCheckOption:   defaultUrlPathCheck,
 		UrlPathMap:           nil,
-		UrlPathTrie:          nil,
 		LoadBalancerType:     defaultLoadBalancerType,
 		InitServerList:       nil,
 		KeepAliveOption:      defaultKeepAliveOption,
+		HashKey:              defaultHashKey,
+		StickySession: StickySessionConfig{
+			Enable:     false,
+			CookieName: DefaultStickyCookieName,
+			TTL:        defaultStickyTTL,
+			Secure:     false,
+			Secret:     RandomSecret(),
+		},
+		ConcurrencyLimit: ConcurrencyLimitConfig{
+			Enable:       false,
+			InitialLimit: server.DefaultInitialLimit,
+			MinLimit:     server.DefaultMinLimit,
+			MaxLimit:     server.DefaultMaxLimit,
+			Tolerance:    server.DefaultTolerance,
+			Backoff:      server.DefaultBackoff,
+			RetryAfter:   DefaultRetryAfter,
+		},
+		Mirror: MirrorOptionConfig{
+			MaxConcurrency: DefaultMirrorConcurrency,
+			MaxBodySize:    DefaultMirrorMaxBodySize,
+			Timeout:        DefaultMirrorTimeout,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			ConsecutiveFailures: server.DefaultConsecutiveFailures,
+			MinRequests:         server.DefaultBreakerMinRequests,
+			Window:              server.DefaultBreakerWindow,
+			OpenDuration:        server.DefaultOpenDuration,
+			HalfOpenRequests:    server.DefaultHalfOpenRequests,
+		},
+		OutlierDetection: OutlierDetectionConfig{
+			Enable:             false,
+			ConsecutiveErrors:  DefaultOutlierConsecutiveErrors,
+			Interval:           DefaultOutlierInterval,
+			ErrorRateFactor:    DefaultOutlierErrorRateFactor,
+			MinErrorRate:       DefaultOutlierMinErrorRate,
+			MinRequests:        DefaultOutlierMinRequests,
+			MinServers:         DefaultOutlierMinServers,
+			BaseEjectionTime:   DefaultBaseEjectionTime,
+			MaxEjectionTime:    DefaultMaxEjectionTime,
+			MaxEjectionPercent: DefaultMaxEjectionPercent,
+		},
+		Retry: RetryConfig{
+			Enable:      false,
+			MaxAttempts: DefaultRetryMaxAttempts,
+			MaxBodySize: DefaultRetryMaxBodySize,
+		},
 	}
 	yamlData, err := yaml.Marshal(&pc)
 	if err != nil {
@@ -136,15 +446,39 @@ func createDefaultConfig(file *os.File) (*ProxyConfig, error) {
 	return pc, nil
 }
 
+// RandomSecret 生成一个随机密钥（十六进制字符串）
+func RandomSecret() string {
+	buf := make([]byte, stickySecretLength)
+	_, err := rand.Read(buf)
+	if err != nil {
+		sysPrint.PrintlnErrorMsg("Failed to generate random secret: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
 // WriteConfig 将 proxyConfig 写入本地配置文件
+// 先写入同目录下的临时文件，再重命名覆盖原配置文件，写入失败时原配置文件保持不变
 func WriteConfig(pc *ProxyConfig) error {
-	file, err := os.OpenFile(ConfigFilePath, os.O_RDWR|os.O_CREATE, 0644)
 	yamlData, err := yaml.Marshal(&pc)
 	if err != nil {
 		return err
 	}
+	file, err := ioutil.TempFile(filepath.Dir(ConfigFilePath), filepath.Base(ConfigFilePath)+".tmp")
+	if err != nil {
+		return err
+	}
 	_, err = file.Write(yamlData)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), ConfigFilePath)
+	}
 	if err != nil {
+		_ = os.Remove(file.Name())
 		return err
 	}
 	return nil
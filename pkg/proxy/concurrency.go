@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb"
+	"EH-Proxy/pkg/system/sysPrint"
+	"net/http"
+	"strconv"
+)
+
+const (
+	maxSelectRetry        = 3 // 选中的服务器达到并发限制时，使用负载均衡器重新选择的最大次数
+	ServiceUnavailableMsg = "Service unavailable, please retry later."
+)
+
+// acquireServer 从服务器组 sg 中选择一个服务器并占用其一个并发名额
+// 开启会话保持时优先使用 cookie 记录的服务器，否则使用 selectServer 选择服务器并记录到 cookie 中。
+// 所有服务器都不可用或达到并发限制时返回 nil
+func (p *proxy) acquireServer(sg *ServerGroup, w http.ResponseWriter, r *http.Request) *server.Server {
+	sticky := p.config.StickySession.Enable
+	if sticky {
+		if s := p.stickyServer(sg, r); s != nil && s.TryAcquire() {
+			return s
+		}
+	}
+	s := p.selectServer(sg, r)
+	if s != nil && sticky {
+		p.setStickyCookie(sg, w, s)
+	}
+	return s
+}
+
+// selectServer 使用负载均衡器从服务器组 sg 中选择一个 exclude 以外的服务器并占用其一个并发名额
+// 选中的服务器达到并发限制或在 exclude 中时重新选择，重试 maxSelectRetry 次后在优先级最高的可用服务器层中选择（见 ServerGroup.TryAcquireAny）。
+// 所有服务器都不可用或该层服务器都达到并发限制时返回 nil
+func (p *proxy) selectServer(sg *ServerGroup, r *http.Request, exclude ...*server.Server) *server.Server {
+	// 哈希类负载均衡器首次根据请求的哈希键选择节点，重试时不再按键选择，避免总是选中同一个节点
+	lb := sg.LoadBalancer()
+	keyedLB, keyed := lb.(slb.KeyedLoadBalancer)
+	var s *server.Server
+	for i := 0; i < maxSelectRetry && s == nil; i++ {
+		var selected *server.Server
+		var err error
+		if keyed && i == 0 && len(exclude) == 0 {
+			selected, err = keyedLB.SelectNodeByKey(requestHashKey(r, p.config.HashKey))
+		} else {
+			selected, err = lb.SelectNode()
+		}
+		if err != nil {
+			if err != sysPrint.ErrNoServer {
+				sysPrint.PrintlnAndLogWriteErrorMsg(err.Error())
+			}
+			return nil
+		}
+		if !containsServer(exclude, selected) && selected.TryAcquire() {
+			s = selected
+		}
+	}
+	if s == nil {
+		s = sg.TryAcquireAny(exclude...)
+	}
+	return s
+}
+
+// writeServiceUnavailable 返回 503，并通过 Retry-After 响应头告知客户端重试间隔（秒）
+func (p *proxy) writeServiceUnavailable(w http.ResponseWriter) {
+	retryAfter := int64(p.config.ConcurrencyLimit.RetryAfter.Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, err := w.Write([]byte(ServiceUnavailableMsg))
+	if err != nil {
+		sysPrint.PrintlnErrorMsg(err.Error())
+	}
+}
+
+// statusRecorder 记录响应状态码的 http.ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush 支持流式响应
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// overloaded 响应状态码是否表示服务器过载或故障
+func (r *statusRecorder) overloaded() bool {
+	return overloadedStatus(r.status)
+}
+
+// overloadedStatus 状态码是否表示服务器过载或故障
+func overloadedStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HashKeyClientIP     = "ip"
+	hashKeyHeaderPrefix = "header:"
+	hashKeyCookiePrefix = "cookie:"
+)
+
+// clientIP 获取请求的客户端 IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestValue 根据来源从请求中取出值，source: header:<name> / cookie:<name>，取不到值时返回空字符串
+func requestValue(r *http.Request, source string) string {
+	switch {
+	case strings.HasPrefix(source, hashKeyHeaderPrefix):
+		return r.Header.Get(source[len(hashKeyHeaderPrefix):])
+	case strings.HasPrefix(source, hashKeyCookiePrefix):
+		if c, err := r.Cookie(source[len(hashKeyCookiePrefix):]); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// requestHashKey 根据配置的哈希键来源从请求中取出哈希键
+// source: ip / header:<name> / cookie:<name>，取不到值时使用客户端 IP
+func requestHashKey(r *http.Request, source string) string {
+	if v := requestValue(r, source); v != "" {
+		return v
+	}
+	return clientIP(r)
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/system/sysPrint"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// hopHeaders 逐跳请求头，不转发给影子服务器
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// mirror 请求镜像
+type mirror struct {
+	group   *ServerGroup // 影子服务器组
+	percent float64      // 镜像的请求比例（0~100）
+}
+
+// newMirror 根据镜像配置创建 mirror，影子服务器组不存在或比例无效时返回错误
+func newMirror(mc *config.MirrorConfig, groups map[string]*ServerGroup) (*mirror, error) {
+	group, ok := groups[mc.Group]
+	if !ok {
+		return nil, sysPrint.ErrGroupNotExists
+	}
+	if mc.Percent < 0 || mc.Percent > 100 {
+		return nil, sysPrint.ErrMirrorPercentInvalid
+	}
+	return &mirror{group: group, percent: mc.Percent}, nil
+}
+
+// sampled 按比例决定是否镜像本次请求
+func (m *mirror) sampled() bool {
+	return m.percent > 0 && rand.Float64()*100 < m.percent
+}
+
+// readCloser 组合 Reader 与原请求体的 Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bufferBody 将请求体读入内存并用读取的内容替换 r.Body，返回请求体内容，没有请求体时返回 nil
+// 请求体超过 maxSize 或读取失败时返回 false，此时 r.Body 仍能读出完整的请求体（或原来的读取错误）
+func bufferBody(r *http.Request, maxSize int64) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > maxSize {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil || int64(len(body)) > maxSize {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body = readCloser{bytes.NewReader(body), r.Body}
+	return body, true
+}
+
+// mirrorRequest 复制请求并在后台发送给路由的影子服务器组，不等待镜像请求完成
+// 同时进行的镜像请求数达到上限、请求体超过大小上限或读取请求体失败时放弃镜像，原请求总是保持完整
+func (p *proxy) mirrorRequest(rt *route, r *http.Request) {
+	select {
+	case p.mirrorSem <- struct{}{}:
+	default:
+		return
+	}
+	body, ok := bufferBody(r, p.config.Mirror.MaxBodySize)
+	if !ok {
+		<-p.mirrorSem
+		return
+	}
+
+	// 镜像请求不受客户端连接关闭的影响，只受镜像超时时间限制
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Mirror.Timeout)
+	req := r.Clone(ctx)
+	req.RequestURI = ""
+	req.TransferEncoding = nil
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	} else {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	ip := clientIP(r)
+	if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+		ip = prior + ", " + ip
+	}
+	req.Header.Set("X-Forwarded-For", ip)
+
+	go func() {
+		defer func() {
+			cancel()
+			<-p.mirrorSem
+		}()
+		p.sendMirror(rt, req)
+	}()
+}
+
+// sendMirror 使用影子服务器组的负载均衡器选择服务器并发送镜像请求，响应被丢弃
+func (p *proxy) sendMirror(rt *route, req *http.Request) {
+	sg := rt.mirror.group
+	s := p.selectServer(sg, req)
+	if s == nil {
+		return
+	}
+	req.URL.Scheme = "http"
+	req.URL.Host = s.Addr()
+	if rt.rewrite != nil {
+		rt.rewrite.apply(req, s.Addr())
+	}
+
+	sysPrint.LogWriteSystemMsg(sg.Name() + " mirror:" + req.RemoteAddr + " -> " + s.Addr())
+	start := time.Now()
+	resp, err := p.mirrorTransport.RoundTrip(req)
+	dropped, failed := true, true
+	if err != nil {
+		sysPrint.LogWriteErrorMsg("mirror request to " + s.Addr() + " failed: " + err.Error())
+	} else {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		dropped = overloadedStatus(resp.StatusCode)
+		failed = resp.StatusCode >= http.StatusInternalServerError
+	}
+	s.ReleaseResult(time.Since(start), dropped, failed)
+}
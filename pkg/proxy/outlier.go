@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// outlierStats 服务器的异常检测统计
+type outlierStats struct {
+	requests    int64 // 当前检测周期内的请求数
+	errors      int64 // 当前检测周期内的错误数
+	consecutive int32 // 连续错误次数
+	ejections   int32 // 连续驱逐次数，决定下次驱逐的时长，由 outlierDetector.lock 保护
+}
+
+// outlierDetector 服务器组的被动异常检测器，根据实际转发请求的结果驱逐异常的服务器
+type outlierDetector struct {
+	group *ServerGroup
+	opts  config.OutlierDetectionConfig
+	lock  sync.RWMutex
+	stats map[*server.Server]*outlierStats
+}
+
+// newOutlierDetector 创建服务器组 sg 的异常检测器，值为 0 的选项使用默认值
+func newOutlierDetector(sg *ServerGroup, opts config.OutlierDetectionConfig) *outlierDetector {
+	if opts.ConsecutiveErrors <= 0 {
+		opts.ConsecutiveErrors = config.DefaultOutlierConsecutiveErrors
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = config.DefaultOutlierInterval
+	}
+	if opts.ErrorRateFactor <= 1 {
+		opts.ErrorRateFactor = config.DefaultOutlierErrorRateFactor
+	}
+	if opts.MinErrorRate <= 0 {
+		opts.MinErrorRate = config.DefaultOutlierMinErrorRate
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = config.DefaultOutlierMinRequests
+	}
+	if opts.MinServers <= 0 {
+		opts.MinServers = config.DefaultOutlierMinServers
+	}
+	if opts.BaseEjectionTime <= 0 {
+		opts.BaseEjectionTime = config.DefaultBaseEjectionTime
+	}
+	if opts.MaxEjectionTime < opts.BaseEjectionTime {
+		opts.MaxEjectionTime = config.DefaultMaxEjectionTime
+		if opts.MaxEjectionTime < opts.BaseEjectionTime {
+			opts.MaxEjectionTime = opts.BaseEjectionTime
+		}
+	}
+	if opts.MaxEjectionPercent <= 0 || opts.MaxEjectionPercent > 100 {
+		opts.MaxEjectionPercent = config.DefaultMaxEjectionPercent
+	}
+	return &outlierDetector{group: sg, opts: opts, stats: make(map[*server.Server]*outlierStats)}
+}
+
+// statsOf 获取服务器的统计，不存在时创建
+func (d *outlierDetector) statsOf(s *server.Server) *outlierStats {
+	d.lock.RLock()
+	st, ok := d.stats[s]
+	d.lock.RUnlock()
+	if ok {
+		return st
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if st, ok = d.stats[s]; !ok {
+		st = &outlierStats{}
+		d.stats[s] = st
+	}
+	return st
+}
+
+// onResult 记录一次请求的结果，failed 表示请求失败（连接错误、超时或 5xx 响应），连续错误次数达到阈值时驱逐服务器
+func (d *outlierDetector) onResult(s *server.Server, failed bool) {
+	st := d.statsOf(s)
+	atomic.AddInt64(&st.requests, 1)
+	if !failed {
+		atomic.StoreInt32(&st.consecutive, 0)
+		return
+	}
+	atomic.AddInt64(&st.errors, 1)
+	if atomic.AddInt32(&st.consecutive, 1) >= d.opts.ConsecutiveErrors {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.eject(s, st, strconv.Itoa(int(atomic.LoadInt32(&st.consecutive)))+" consecutive errors")
+	}
+}
+
+// eject 驱逐服务器，驱逐时长随连续驱逐次数指数增长，到期后自动恢复
+// 服务器已被驱逐、组内被驱逐的服务器数已达上限或组内没有其他可用服务器时不驱逐，调用方需持有写锁
+// 上限为服务器数 * max-ejection-percent，至少为 1，使小规模的组也能驱逐异常服务器
+func (d *outlierDetector) eject(s *server.Server, st *outlierStats, reason string) bool {
+	if s.Ejected() {
+		return false
+	}
+	d.group.mapRWLock.RLock()
+	total, ejected, available := len(d.group.serverMap), 0, 0
+	for _, sv := range d.group.serverMap {
+		if sv.Ejected() {
+			ejected++
+		} else if sv != s && sv.Available() {
+			available++
+		}
+	}
+	d.group.mapRWLock.RUnlock()
+	maxEjected := total * int(d.opts.MaxEjectionPercent) / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	if ejected >= maxEjected || available == 0 {
+		return false
+	}
+
+	duration := d.opts.BaseEjectionTime
+	for i := int32(0); i < st.ejections && duration < d.opts.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+	if duration > d.opts.MaxEjectionTime {
+		duration = d.opts.MaxEjectionTime
+	}
+	st.ejections++
+	atomic.StoreInt32(&st.consecutive, 0)
+	s.SetEjected(true)
+	sysPrint.PrintlnAndLogWriteSystemMsg(s.Addr() + " is ejected for " + duration.String() + ", reason: " + reason + ".")
+	time.AfterFunc(duration, func() {
+		s.SetEjected(false)
+		sysPrint.PrintlnAndLogWriteSystemMsg(s.Addr() + " ejection expired, now back in the pool.")
+	})
+	return true
+}
+
+// run 每个检测周期执行一次 detect
+func (d *outlierDetector) run() {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.detect()
+	}
+}
+
+// detect 按错误率驱逐服务器并重置周期统计
+// 周期内请求数达到 min-requests 的未被驱逐服务器数不少于 min-servers 时，驱逐错误率不低于 min-error-rate
+// 且超过这些服务器平均错误率 error-rate-factor 倍的服务器；未被驱逐的服务器的连续驱逐次数减 1
+func (d *outlierDetector) detect() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// 删除已从组中删除的服务器的统计
+	d.group.mapRWLock.RLock()
+	for s := range d.stats {
+		if d.group.serverMap[s.Addr()] != s {
+			delete(d.stats, s)
+		}
+	}
+	d.group.mapRWLock.RUnlock()
+
+	rates := make(map[*server.Server]float64)
+	var sum float64
+	for s, st := range d.stats {
+		requests := atomic.SwapInt64(&st.requests, 0)
+		errors := atomic.SwapInt64(&st.errors, 0)
+		if s.Ejected() {
+			continue
+		}
+		if st.ejections > 0 {
+			st.ejections--
+		}
+		if requests >= int64(d.opts.MinRequests) {
+			rate := float64(errors) / float64(requests)
+			rates[s] = rate
+			sum += rate
+		}
+	}
+	if len(rates) < int(d.opts.MinServers) {
+		return
+	}
+	threshold := sum / float64(len(rates)) * d.opts.ErrorRateFactor
+	for s, rate := range rates {
+		if rate >= d.opts.MinErrorRate && rate > threshold {
+			d.eject(s, d.stats[s], "error rate "+strconv.FormatFloat(rate*100, 'f', 1, 64)+"%")
+		}
+	}
+}
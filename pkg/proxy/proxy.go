@@ -1,14 +1,12 @@
 package proxy
 
 import (
+	"EH-Proxy/config"
 	"EH-Proxy/pkg/server"
 	"EH-Proxy/pkg/system/sysPrint"
 	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
 	"sync"
@@ -58,40 +56,26 @@ var (
 func HttpHandleRequest(w http.ResponseWriter, r *http.Request) {
 	p := GetProxyInstance()
 
-	// Url 路径检测（如果启用了 Url 路径检测功能）
+	// Url 路径检测（如果启用了 Url 路径检测功能），被拒绝的请求不再转发
 	if p.config.UrlPathCheckOption {
-		path := r.URL.Path
-		if _, ok := p.config.UrlPathMap[path]; !ok {
-			if !p.config.UrlPathTrie.PrefixSearch(path) {
-				w.WriteHeader(http.StatusBadRequest)
-				_, err := w.Write(invalidURLPath)
-				if err != nil {
-					return
-				}
-			}
-		}
-	}
-
-	// 使用负载均衡器选择一个节点进行转发
-	s, err := p.serverGroup.loadBalancer.SelectNode()
-	if err != nil {
-		if err == sysPrint.ErrNoServer {
-			fmt.Println(err)
+		if resp := p.checkUrlPath(r.URL.Path); resp != nil {
+			resp.write(w)
+			return
 		}
-		log.Fatalln(err)
 	}
 
-	targetURL, err := url.Parse(HttpScheme + s.Addr())
-	if err != nil {
-		log.Fatal(err)
+	// 根据路由表选择服务器组，再从组中选择一个服务器进行转发，所有服务器都不可用或达到并发限制时返回 503
+	rt := p.route(r)
+	sg := rt.serverGroup(r)
+	s := p.acquireServer(sg, w, r)
+	if s == nil {
+		p.writeServiceUnavailable(w)
+		return
 	}
 
-	// 创建 ReverseProxy 对象
-	reverseProxy := revProxyPool.Get()
-	reverseProxy.Director = func(req *http.Request) {
-		// 修改请求的目标地址为目标URL
-		req.URL.Scheme = targetURL.Scheme
-		req.URL.Host = targetURL.Host
+	// 按比例将请求镜像到影子服务器组
+	if rt.mirror != nil && rt.mirror.sampled() {
+		p.mirrorRequest(rt, r)
 	}
 
 	var ctx context.Context
@@ -104,35 +88,59 @@ func HttpHandleRequest(w http.ResponseWriter, r *http.Request) {
 		r = r.WithContext(ctx)
 	}
 
-	sysPrint.LogWriteSystemMsg(string(p.config.LoadBalancerType) + " load balance:" + r.RemoteAddr + " -> " + s.Addr())
-	s.IncrActiveReq() // 增加服务器活跃请求数
-	reverseProxy.ServeHTTP(w, r)
-	s.DecrActiveReq() // 减少服务器活跃请求数
-
-	// 如果启用了断路器，检查请求是否超时
-	if p.config.CircuitBreakerOption {
-		select {
-		case <-ctx.Done():
-			if p.config.HealthCheckOption && s.Probe() != server.NoHealthCheck {
-				s.SetPfail(server.IS_PFAIL) // 将超时服务器设为下线状态
-				sysPrint.PrintlnAndLogWriteSystemMsg("Request for server:" + s.Addr() + " timeout,now considering it failure.")
-				w.WriteHeader(http.StatusRequestTimeout)
-				_, err = w.Write([]byte(RequestTimeoutMsg))
-				if err != nil {
-					sysPrint.PrintlnErrorMsg(err.Error())
-					return
+	// 转发失败时选择另一个未尝试过的服务器重试，没有其他可选的服务器时直接返回本次尝试的响应
+	reverseProxy := revProxyPool.Get()
+	rec := &statusRecorder{ResponseWriter: w}
+	attempts, body := p.retry.attempts(r)
+	var timeout time.Duration
+	if attempts > 1 {
+		timeout = p.retry.perTryTimeout
+	}
+	tried := make([]*server.Server, 0, attempts)
+	for attempt := 1; ; attempt++ {
+		sysPrint.LogWriteSystemMsg(sg.Name() + " " + string(sg.LoadBalancerType()) + " load balance:" + r.RemoteAddr + " -> " + s.Addr())
+		tried = append(tried, s)
+		var selectNext func() *server.Server
+		if attempt < attempts {
+			// 客户端已断开时不再重试
+			selectNext = func() *server.Server {
+				if r.Context().Err() != nil {
+					return nil
 				}
+				return p.selectServer(sg, r, tried...)
+			}
+		}
+		next, err := p.forward(reverseProxy, rt, sg, s, rec, r, body, timeout, selectNext)
+		if next == nil {
+			if err != nil {
+				sysPrint.LogWriteErrorMsg("request to " + s.Addr() + " failed: " + err.Error())
 			}
-		default:
+			break
+		}
+		sysPrint.LogWriteSystemMsg("request to " + s.Addr() + " failed: " + err.Error() + ", retry on " + next.Addr())
+		if p.config.StickySession.Enable {
+			rec.Header().Del("Set-Cookie")
+			p.setStickyCookie(sg, rec, next)
 		}
+		s = next
 	}
 
+	// 如果启用了断路器，请求超时时返回提示信息，超时已作为失败计入服务器的断路器
+	if p.config.CircuitBreakerOption && ctx.Err() == context.DeadlineExceeded {
+		sysPrint.LogWriteSystemMsg("Request for server:" + s.Addr() + " timeout.")
+		_, err := rec.Write([]byte(RequestTimeoutMsg))
+		if err != nil {
+			sysPrint.PrintlnErrorMsg(err.Error())
+		}
+	}
 }
 
 func (p *proxy) Serve() {
 	if p.config.HealthCheckOption {
-		for _, s := range p.serverGroup.ServerMap() {
-			go p.healthCheck(s)
+		for _, sg := range p.serverGroups {
+			for _, s := range sg.ServerMap() {
+				go p.healthCheck(sg, s)
+			}
 		}
 	}
 	httpServer := &http.Server{
@@ -166,7 +174,7 @@ func (p *proxy) Serve() {
 }
 
 // healthCheck 对服务器进行健康检测
-func (p *proxy) healthCheck(s *server.Server) {
+func (p *proxy) healthCheck(sg *ServerGroup, s *server.Server) {
 	if s.Probe() == server.NoHealthCheck {
 		return
 	}
@@ -176,7 +184,7 @@ func (p *proxy) healthCheck(s *server.Server) {
 			return
 		}
 		s.SetPfail(server.IS_PFAIL)
-		p.serverGroup.addPfailCount(1)
+		sg.addPfailCount(1)
 		sysPrint.PrintlnAndLogWriteSystemMsg(s.Addr() + " is considered failure.")
 	}
 
@@ -197,8 +205,9 @@ func (p *proxy) healthCheck(s *server.Server) {
 				}
 				s.SetLastAck(curtime)
 				if s.Pfail() == server.IS_PFAIL {
+					s.StartSlowStart() // 恢复上线的服务器重新进行慢启动
 					s.SetPfail(server.NOT_PFAIL)
-					p.serverGroup.addPfailCount(-1)
+					sg.addPfailCount(-1)
 					sysPrint.PrintlnAndLogWriteSystemMsg(s.Addr() + " is back online.")
 				}
 			}
@@ -215,8 +224,32 @@ func (p *proxy) Shutdown() {
 
 // beforeExit 退出前执行逻辑
 func (p *proxy) beforeExit() {
-	err := p.serverGroup.saveServerListToDisk() // 将当前服务器列表保存到本地配置文件
+	err := p.saveConfigToDisk() // 将当前服务器列表保存到本地配置文件
 	if err != nil {
 		sysPrint.PrintlnErrorMsg(err.Error())
 	}
 }
+
+// saveConfigToDisk 将各服务器组当前的负载均衡器类型与服务器列表，以及当前的 URL 路径保存到本地配置文件
+func (p *proxy) saveConfigToDisk() error {
+	p.config.LoadBalancerType = p.serverGroup.LoadBalancerType()
+	p.config.UrlPathMap = p.urlPathTable().paths
+	p.config.InitServerList = p.serverGroup.serverConfigList(p)
+	for i := range p.config.ServerGroups {
+		gc := &p.config.ServerGroups[i]
+		sg, ok := p.serverGroups[gc.Name]
+		if !ok {
+			continue
+		}
+		if balancerType := sg.LoadBalancerType(); balancerType != p.config.LoadBalancerType || gc.LoadBalancerType != "" {
+			gc.LoadBalancerType = balancerType
+		}
+		gc.ServerList = sg.serverConfigList(p)
+	}
+	err := config.WriteConfig(p.config)
+	if err != nil {
+		return err
+	}
+	sysPrint.PrintlnSystemMsg("Save current config to disk success.")
+	return nil
+}
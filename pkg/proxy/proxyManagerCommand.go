@@ -1,7 +1,9 @@
 package proxy
 
 import (
+	"EH-Proxy/config"
 	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb"
 	"EH-Proxy/pkg/system/sysPrint"
 	"EH-Proxy/pkg/utils/byteStringConv"
 	"strconv"
@@ -13,12 +15,14 @@ const (
 	errSyntaxErr       = sysPrint.ERROR + "syntax error"
 	trueString         = "true"
 	falseString        = "false"
+	groupArgPrefix     = '@' // 服务器组参数前缀
 )
 
 var (
 	ServerExistsReply    = []byte("true")
 	ServerNotExistsReply = []byte("false")
 	ServerSaveErr        = []byte("Save failed.")
+	EmptyPathListReply   = []byte("(empty list)")
 )
 
 // RegisterCommand 注册命令，命令名全小写输入
@@ -28,9 +32,38 @@ func (pm *proxyManager) RegisterCommand(cmdName string, cmdFunc func(c *client,
 	}
 }
 
+// groupArg 解析命令的服务器组参数
+// 命令名后的第一个参数以 @ 开头时表示服务器组名称（如 AddServer @api 127.0.0.1:8080），
+// 返回该服务器组与去掉服务器组参数后的参数列表；未指定服务器组时使用默认服务器组
+func groupArg(args [][]byte) (*ServerGroup, [][]byte, error) {
+	p := GetProxyInstance()
+	if len(args) < 2 || len(args[1]) == 0 || args[1][0] != groupArgPrefix {
+		return p.serverGroup, args, nil
+	}
+	sg, err := p.ServerGroup(string(args[1][1:]))
+	if err != nil {
+		return nil, nil, err
+	}
+	newArgs := make([][]byte, 0, len(args)-1)
+	newArgs = append(newArgs, args[0])
+	newArgs = append(newArgs, args[2:]...)
+	return sg, newArgs, nil
+}
+
 func writeServerInfo(builder *strings.Builder, s *server.Server) {
 	builder.WriteString("address: " + s.Addr() + "\n")
 	builder.WriteString("weight: " + strconv.FormatInt(int64(s.Weight()), 10) + "\n")
+	if s.IsBackup() {
+		builder.WriteString("tier: backup\n")
+	} else {
+		builder.WriteString("tier: priority " + strconv.FormatInt(int64(s.Priority()), 10) + "\n")
+	}
+	if s.SlowStart() > 0 {
+		builder.WriteString("slow start: " + strconv.FormatInt(s.SlowStart().Milliseconds(), 10) + "ms\n")
+		if s.InSlowStart() {
+			builder.WriteString("effective weight: " + strconv.FormatInt(int64(s.EffectiveWeight()), 10) + "\n")
+		}
+	}
 	if s.Probe() != server.NoHealthCheck {
 		builder.WriteString("probe: " + s.Probe() + "\n")
 		builder.WriteString("last ack timestamp: " + strconv.FormatInt(int64(s.LastAck()), 10) + "\n")
@@ -41,9 +74,83 @@ func writeServerInfo(builder *strings.Builder, s *server.Server) {
 	} else {
 		builder.WriteString(falseString + "\n")
 	}
+	builder.WriteString("drain:")
+	if s.Draining() {
+		builder.WriteString(trueString + "\n")
+	} else {
+		builder.WriteString(falseString + "\n")
+	}
+	builder.WriteString("ejected:")
+	if s.Ejected() {
+		builder.WriteString(trueString + "\n")
+	} else {
+		builder.WriteString(falseString + "\n")
+	}
+	if s.Breaker() != nil {
+		builder.WriteString("circuit breaker: " + s.BreakerState().String() + "\n")
+	}
+	if limit := s.ConcurrencyLimit(); limit > 0 {
+		builder.WriteString("concurrency limit: " + strconv.FormatInt(int64(limit), 10) + "\n")
+	}
 	builder.WriteString("active requests: " + strconv.FormatInt(int64(s.ActiveReq()), 10) + "\n\n")
 }
 
+// writeMatchInfo 输出请求头或查询参数匹配条件，如 X-Tenant=beta、X-Tenant^=be、X-Tenant~=^b
+func writeMatchInfo(builder *strings.Builder, kind string, mc config.MatchConfig) {
+	builder.WriteString(" " + kind + ":" + mc.Name)
+	switch {
+	case mc.Exact != "":
+		builder.WriteString("=" + mc.Exact)
+	case mc.Prefix != "":
+		builder.WriteString("^=" + mc.Prefix)
+	case mc.Regex != "":
+		builder.WriteString("~=" + mc.Regex)
+	}
+}
+
+// writeRouteInfo 输出路由规则，如 POST api.example.com/upload header:X-Tenant=beta -> storage、
+// *.example.com/ -> stable:95,canary:5 (web)
+func writeRouteInfo(builder *strings.Builder, rc config.RouteConfig) {
+	if len(rc.Methods) > 0 {
+		builder.WriteString(strings.ToUpper(strings.Join(rc.Methods, ",")) + " ")
+	}
+	host, pathPrefix := rc.Host, rc.PathPrefix
+	if host == "" {
+		host = "*"
+	}
+	if pathPrefix == "" {
+		pathPrefix = "/"
+	}
+	builder.WriteString(host + pathPrefix)
+	if rc.Path != "" {
+		builder.WriteString(" path:" + rc.Path)
+	}
+	for _, mc := range rc.Headers {
+		writeMatchInfo(builder, "header", mc)
+	}
+	for _, mc := range rc.Query {
+		writeMatchInfo(builder, "query", mc)
+	}
+	builder.WriteString(" -> ")
+	if rc.Split != nil {
+		for i, gc := range rc.Split.Groups {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(gc.Group + ":" + strconv.FormatInt(int64(gc.Weight), 10))
+		}
+	} else {
+		builder.WriteString(rc.Group)
+	}
+	if rc.Mirror != nil {
+		builder.WriteString(" mirror:" + rc.Mirror.Group + ":" + strconv.FormatFloat(rc.Mirror.Percent, 'f', -1, 64) + "%")
+	}
+	if rc.Name != "" {
+		builder.WriteString(" (" + rc.Name + ")")
+	}
+	builder.WriteString("\n")
+}
+
 // execInfo info 命令
 // 获取 proxy 相关信息
 func execInfo(c *client, args [][]byte) error {
@@ -85,13 +192,41 @@ func execInfo(c *client, args [][]byte) error {
 		builder.WriteString(falseString + "\n")
 	}
 
-	builder.WriteString("load balance type: " + string(p.config.LoadBalancerType) + "\n")
+	builder.WriteString("retry option: ")
+	if p.retry != nil {
+		builder.WriteString(trueString + "\n")
+		builder.WriteString("retry max attempts: " + strconv.Itoa(p.retry.maxAttempts) + "\n")
+		if p.retry.perTryTimeout > 0 {
+			builder.WriteString("retry per-try timeout: " + strconv.FormatInt(p.retry.perTryTimeout.Milliseconds(), 10) + "ms\n")
+		}
+	} else {
+		builder.WriteString(falseString + "\n")
+	}
+
+	builder.WriteString("load balance type: " + string(p.serverGroup.LoadBalancerType()) + "\n")
+	if p.config.SlowStart > 0 {
+		builder.WriteString("slow start: " + strconv.FormatInt(p.config.SlowStart.Milliseconds(), 10) + "ms\n")
+	}
 	builder.WriteString("url path check option: ")
 	if p.config.UrlPathCheckOption {
 		builder.WriteString(trueString + "\n")
+		table := p.urlPathTable()
+		mode := config.UrlPathCheckAllow
+		if table.deny {
+			mode = config.UrlPathCheckDeny
+		}
+		builder.WriteString("url path check mode: " + mode + "\n")
 		builder.WriteString("url path:\n")
-		for path := range p.config.UrlPathMap {
-			builder.WriteString("\t- " + path + "\n")
+		for _, path := range p.UrlPaths() {
+			builder.WriteString("\t- " + path)
+			if resp, err := table.pathResponseOf(table.paths[path]); err == nil && resp != nil {
+				builder.WriteString(" (" + strconv.Itoa(resp.status))
+				if resp.location != "" {
+					builder.WriteString(" -> " + resp.location)
+				}
+				builder.WriteString(")")
+			}
+			builder.WriteString("\n")
 		}
 	} else {
 		builder.WriteString(falseString + "\n")
@@ -108,6 +243,31 @@ func execInfo(c *client, args [][]byte) error {
 		writeServerInfo(&builder, s)
 	}
 
+	// 其他服务器组按配置顺序输出
+	for _, gc := range p.config.ServerGroups {
+		sg, ok := p.serverGroups[gc.Name]
+		if !ok {
+			continue
+		}
+		builder.WriteString("[Server Group " + sg.Name() + "]\n")
+		builder.WriteString("load balance type: " + string(sg.LoadBalancerType()) + "\n")
+		builder.WriteString("number of pfail servers: " + strconv.FormatInt(int64(sg.PfailCount()), 10) + "\n\n")
+		idx = 0
+		for _, s := range sg.ServerMap() {
+			idx++
+			builder.WriteString("-----server" + strconv.Itoa(idx) + "-----\n")
+			writeServerInfo(&builder, s)
+		}
+	}
+
+	if len(p.config.Routes) > 0 {
+		builder.WriteString("[Route]\n")
+		for _, rc := range p.config.Routes {
+			builder.WriteString("\t- ")
+			writeRouteInfo(&builder, rc)
+		}
+	}
+
 	err := c.Reply(byteStringConv.StringToBytes(builder.String()))
 	if err != nil {
 		return err
@@ -116,12 +276,18 @@ func execInfo(c *client, args [][]byte) error {
 }
 
 // execAddServer 添加服务器命令
-// 输入格式：AddServer [addr] [weight] [probe]
+// 输入格式：AddServer [@group] [addr] [weight] [probe]
 // 示例：AddServer 127.0.0.1:8080 200 http://127.0.0.1:8081/check/
+// @group 填服务器组名称（如 @api），可以为空，则操作默认服务器组，其他服务器相关命令同理
 // addr 填服务器地址，不需要加 scheme（请求时会自动加上 http scheme）
 // weight 权重（1~1000000)，可以为空，则会填充默认值 100
 // probe 需要带上 http scheme(http://) ，可以为空，则不会对该服务器进行健康检测
 func execAddServer(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
 	if len(args) < 2 || len(args) > 5 {
 		err := c.Reply([]byte(errWrongNumberArgs))
 		return err
@@ -129,7 +295,6 @@ func execAddServer(c *client, args [][]byte) error {
 	addr := byteStringConv.BytesToString(args[1])
 	weight := server.DefaultWeight
 	probe := server.NoHealthCheck
-	var err error
 	if len(args) >= 3 {
 		weight, err = strconv.Atoi(byteStringConv.BytesToString(args[2]))
 		if err != nil {
@@ -140,7 +305,7 @@ func execAddServer(c *client, args [][]byte) error {
 	if len(args) == 4 {
 		probe = byteStringConv.BytesToString(args[3])
 	}
-	err = GetProxyInstance().serverGroup.AddServer(GetProxyInstance(), addr, int32(weight), probe)
+	err = sg.AddServer(GetProxyInstance(), addr, int32(weight), probe)
 	if err != nil {
 		if err == sysPrint.ErrServerExists {
 			err = c.Reply([]byte(err.Error()))
@@ -158,16 +323,21 @@ func execAddServer(c *client, args [][]byte) error {
 }
 
 // execDeleteServer 添加服务器命令
-// 输入格式：DeleteServer [addr]
+// 输入格式：DeleteServer [@group] [addr]
 // 示例：DeleteServer 127.0.0.1:8080
 // addr 填服务器地址，不需要加 scheme
 func execDeleteServer(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
 	if len(args) != 2 {
 		err := c.Reply([]byte(errWrongNumberArgs))
 		return err
 	}
 	addr := byteStringConv.BytesToString(args[1])
-	err := GetProxyInstance().serverGroup.DeleteServer(addr)
+	err = sg.DeleteServer(addr)
 	if err != nil {
 		if err == sysPrint.ErrServerNotExists {
 			err = c.Reply([]byte(err.Error()))
@@ -185,17 +355,22 @@ func execDeleteServer(c *client, args [][]byte) error {
 }
 
 // execExistsServer 查询服务器是否存在命令
-// 输入格式：Exists [addr]
+// 输入格式：Exists [@group] [addr]
 // 示例：ExistsServer 127.0.0.1:8080
 // addr 填服务器地址，不需要加 scheme
 // 服务器存在返回 1，否则返回 0
 func execExistsServer(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
 	if len(args) != 2 {
 		err := c.Reply([]byte(errWrongNumberArgs))
 		return err
 	}
 	addr := byteStringConv.BytesToString(args[1])
-	exists := GetProxyInstance().serverGroup.IsServerExists(addr)
+	exists := sg.IsServerExists(addr)
 	if exists == true {
 		err := c.Reply(ServerExistsReply)
 		if err != nil {
@@ -211,16 +386,21 @@ func execExistsServer(c *client, args [][]byte) error {
 }
 
 // execGetServer 获取指定服务器信息命令
-// 输入格式：GetServer [addr]
+// 输入格式：GetServer [@group] [addr]
 // 示例：GetServer 127.0.0.1:8080
 // addr 填服务器地址，不需要加 scheme
 func execGetServer(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
 	if len(args) != 2 {
 		err := c.Reply([]byte(errWrongNumberArgs))
 		return err
 	}
 	addr := byteStringConv.BytesToString(args[1])
-	s, err := GetProxyInstance().serverGroup.GetServer(addr)
+	s, err := sg.GetServer(addr)
 	if err != nil {
 		if err == sysPrint.ErrServerNotExists {
 			err = c.Reply(byteStringConv.StringToBytes(err.Error()))
@@ -241,11 +421,16 @@ func execGetServer(c *client, args [][]byte) error {
 }
 
 // execSetWeight 设置服务器权重
-// 输入格式：SetWeight [addr] [weight]
+// 输入格式：SetWeight [@group] [addr] [weight]
 // 示例：SetWeight 127.0.0.1:8080 200
 // addr 填服务器地址，不需要加 scheme
 // weight 填需要设置的权重
 func execSetWeight(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
 	if len(args) != 3 {
 		err := c.Reply([]byte(errWrongNumberArgs))
 		return err
@@ -256,7 +441,7 @@ func execSetWeight(c *client, args [][]byte) error {
 		err = c.Reply([]byte(errSyntaxErr))
 		return err
 	}
-	err = GetProxyInstance().serverGroup.SetWeight(addr, int32(weight))
+	err = sg.SetWeight(addr, int32(weight))
 	if err != nil {
 		if err == sysPrint.ErrServerNotExists {
 			err = c.Reply(byteStringConv.StringToBytes(err.Error()))
@@ -273,6 +458,184 @@ func execSetWeight(c *client, args [][]byte) error {
 	return nil
 }
 
+// execSetDrain 设置服务器排空状态命令
+// 输入格式：SetDrain [@group] [addr] [true/false]
+// 示例：SetDrain 127.0.0.1:8080 true
+// 排空中的服务器不再接收新请求，已有请求不受影响，同优先级的服务器全部下线或排空时将选择较低优先级的服务器
+func execSetDrain(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	if len(args) != 3 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	addr := byteStringConv.BytesToString(args[1])
+	var drain bool
+	switch byteStringConv.BytesToString(args[2]) {
+	case trueString:
+		drain = true
+	case falseString:
+		drain = false
+	default:
+		err = c.Reply([]byte(errSyntaxErr))
+		return err
+	}
+	err = sg.SetDrain(addr, drain)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	err = c.Reply(ReplyOK)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// execSetLoadBalancer 运行时切换负载均衡算法
+// 输入格式：SetLoadBalancer [@group] [type]
+// 示例：SetLoadBalancer least-active
+// type 填负载均衡器类型，如 round-robin / random / least-active / consistent-hash 等，
+// 切换后执行 Save 命令可将新的负载均衡器类型保存到本地配置文件
+func execSetLoadBalancer(c *client, args [][]byte) error {
+	sg, args, err := groupArg(args)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	if len(args) != 2 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	balancerType := slb.LoadBalancerType(byteStringConv.BytesToString(args[1]))
+	err = sg.SwitchLoadBalancer(balancerType)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	if p := GetProxyInstance(); sg == p.serverGroup {
+		p.config.LoadBalancerType = balancerType
+	}
+	sysPrint.PrintlnAndLogWriteSystemMsg("load balancer of server group " + sg.Name() + " switched to " + string(balancerType) + ".")
+	err = c.Reply(ReplyOK)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// execSetSplit 运行时调整路由的分流权重
+// 输入格式：SetSplit [route] [group:weight] [group:weight] ...
+// 示例：SetSplit api stable:90 canary:10
+// route 填路由名称，路由需已配置 split，未列出的服务器组不再分配流量，
+// 调整后执行 Save 命令可将新的分流权重保存到本地配置文件
+func execSetSplit(c *client, args [][]byte) error {
+	if len(args) < 3 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	p := GetProxyInstance()
+	name := byteStringConv.BytesToString(args[1])
+	rt := p.router.find(name)
+	if rt == nil {
+		err := c.Reply(byteStringConv.StringToBytes(sysPrint.ErrRouteNotExists.Error()))
+		return err
+	}
+	if rt.split == nil {
+		err := c.Reply(byteStringConv.StringToBytes(sysPrint.ErrSplitNotConfigured.Error()))
+		return err
+	}
+	groupConfigs := make([]config.SplitGroupConfig, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		group, weightStr, ok := strings.Cut(string(arg), ":")
+		weight, err := strconv.Atoi(weightStr)
+		if !ok || err != nil {
+			err = c.Reply([]byte(errSyntaxErr))
+			return err
+		}
+		groupConfigs = append(groupConfigs, config.SplitGroupConfig{Group: group, Weight: int32(weight)})
+	}
+	err := rt.split.update(groupConfigs, p.serverGroups)
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	for i := range p.config.Routes {
+		if p.config.Routes[i].Name == name {
+			p.config.Routes[i].Split.Groups = groupConfigs
+		}
+	}
+	sysPrint.PrintlnAndLogWriteSystemMsg("traffic split of route " + name + " updated.")
+	err = c.Reply(ReplyOK)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// execAddPath 向 URL 路径表添加路径
+// 输入格式：AddPath [path]
+// 示例：AddPath /users/:id
+// path 格式同配置文件的 url-path-map，修改立即生效，执行 Save 命令可保存到本地配置文件
+func execAddPath(c *client, args [][]byte) error {
+	if len(args) != 2 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	err := GetProxyInstance().AddUrlPath(string(args[1]))
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	err = c.Reply(ReplyOK)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// execDeletePath 从 URL 路径表删除路径
+// 输入格式：DeletePath [path]
+// 示例：DeletePath /users/:id
+func execDeletePath(c *client, args [][]byte) error {
+	if len(args) != 2 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	err := GetProxyInstance().DeleteUrlPath(string(args[1]))
+	if err != nil {
+		err = c.Reply(byteStringConv.StringToBytes(err.Error()))
+		return err
+	}
+	err = c.Reply(ReplyOK)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// execListPaths 列出 URL 路径表中的路径，每行一个路径
+// 输入格式：ListPaths
+func execListPaths(c *client, args [][]byte) error {
+	if len(args) != 1 {
+		err := c.Reply([]byte(errWrongNumberArgs))
+		return err
+	}
+	paths := GetProxyInstance().UrlPaths()
+	if len(paths) == 0 {
+		err := c.Reply(EmptyPathListReply)
+		return err
+	}
+	err := c.Reply(byteStringConv.StringToBytes(strings.Join(paths, "\n")))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // execShutdown 关闭服务器命令
 // 输入格式：Shutdown
 func execShutdown(c *client, args [][]byte) error {
@@ -297,7 +660,7 @@ func execSave(c *client, args [][]byte) error {
 		return err
 	}
 	p := GetProxyInstance()
-	err := p.serverGroup.saveServerListToDisk()
+	err := p.saveConfigToDisk()
 	if err != nil {
 		err = c.Reply(ServerSaveErr)
 		return err
@@ -315,6 +678,12 @@ func init() {
 	pm.RegisterCommand("addserver", execAddServer)
 	pm.RegisterCommand("deleteserver", execDeleteServer)
 	pm.RegisterCommand("setweight", execSetWeight)
+	pm.RegisterCommand("setloadbalancer", execSetLoadBalancer)
+	pm.RegisterCommand("setdrain", execSetDrain)
+	pm.RegisterCommand("setsplit", execSetSplit)
+	pm.RegisterCommand("addpath", execAddPath)
+	pm.RegisterCommand("deletepath", execDeletePath)
+	pm.RegisterCommand("listpaths", execListPaths)
 	pm.RegisterCommand("exists", execExistsServer)
 	pm.RegisterCommand("getserver", execGetServer)
 	pm.RegisterCommand("shutdown", execShutdown)
@@ -2,10 +2,13 @@ package proxy
 
 import (
 	"EH-Proxy/config"
+	"EH-Proxy/pkg/slb"
 	"EH-Proxy/pkg/system/sysPrint"
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
@@ -191,8 +194,12 @@ func TestProxyManagerCommand(t *testing.T) {
 		t.Errorf("'GETSERVER' command response is not correct, expect:%s, actual:%s", string(ServerNotExistsReply), string(buf[:n]))
 	}
 
-	// test Save
+	// test Save，保存的配置比原配置文件短时，原文件多出的内容不应残留
 	config.ConfigFilePath = "testSaveConfig.yaml"
+	err = ioutil.WriteFile(config.ConfigFilePath, []byte(strings.Repeat("# stale config\n", 10000)), 0644)
+	if err != nil {
+		t.Error(err)
+	}
 	_, err = testClientConnList[0].Write([]byte("SAVE"))
 	if err != nil {
 		t.Error(err)
@@ -216,4 +223,291 @@ func TestProxyManagerCommand(t *testing.T) {
 	if strings.Index(string(data), "server-list") == -1 {
 		t.Error("save to config yaml failed")
 	}
+	if strings.Contains(string(data), "stale config") {
+		t.Error("saved config yaml should not contain stale content")
+	}
+}
+
+func TestProxyManagerCmdSetLoadBalancer(t *testing.T) {
+	buf := make([]byte, ReadBufSize)
+
+	// test SetLoadBalancer
+	_, err := testClientConnList[1].Write([]byte("SETLOADBALANCER least-active"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err := testClientConnList[1].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != string(ReplyOK) {
+		t.Errorf("'SETLOADBALANCER' command response is not correct, expect:%s, actual:%s", string(ReplyOK), string(buf[:n]))
+	}
+	if testProxy.serverGroup.LoadBalancerType() != slb.LeastActive || testProxy.config.LoadBalancerType != slb.LeastActive {
+		t.Errorf("load balancer type is not switched, actual:%s", testProxy.serverGroup.LoadBalancerType())
+	}
+	for i := 0; i < len(testProxy.serverGroup.ServerMap()); i++ {
+		_, err = testProxy.serverGroup.LoadBalancer().SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// test SetLoadBalancer with unknown type
+	_, err = testClientConnList[1].Write([]byte("SETLOADBALANCER unknown"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err = testClientConnList[1].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != sysPrint.ErrUnknownLoadBalancer.Error() {
+		t.Errorf("'SETLOADBALANCER' command response is not correct, expect:%s, actual:%s", sysPrint.ErrUnknownLoadBalancer.Error(), string(buf[:n]))
+	}
+	if testProxy.serverGroup.LoadBalancerType() != slb.LeastActive {
+		t.Errorf("load balancer type should not change, actual:%s", testProxy.serverGroup.LoadBalancerType())
+	}
+
+	// 切换回原负载均衡器
+	_, err = testClientConnList[1].Write([]byte("SETLOADBALANCER round-robin"))
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = testClientConnList[1].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProxyManagerCmdSetDrain(t *testing.T) {
+	buf := make([]byte, ReadBufSize)
+	var addr string
+	for a := range testProxy.serverGroup.ServerMap() {
+		addr = a
+		break
+	}
+	sv, err := testProxy.serverGroup.GetServer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test SetDrain
+	_, err = testClientConnList[2].Write([]byte("SETDRAIN " + addr + " true"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err := testClientConnList[2].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != string(ReplyOK) {
+		t.Errorf("'SETDRAIN' command response is not correct, expect:%s, actual:%s", string(ReplyOK), string(buf[:n]))
+	}
+	if !sv.Draining() {
+		t.Errorf("server %s should be draining", addr)
+	}
+
+	// test SetDrain with syntax error
+	_, err = testClientConnList[2].Write([]byte("SETDRAIN " + addr + " yes"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err = testClientConnList[2].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != errSyntaxErr {
+		t.Errorf("'SETDRAIN' command response is not correct, expect:%s, actual:%s", errSyntaxErr, string(buf[:n]))
+	}
+
+	// test SetDrain with not exists server
+	_, err = testClientConnList[2].Write([]byte("SETDRAIN 127.0.0.1:1 false"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err = testClientConnList[2].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != sysPrint.ErrServerNotExists.Error() {
+		t.Errorf("'SETDRAIN' command response is not correct, expect:%s, actual:%s", sysPrint.ErrServerNotExists.Error(), string(buf[:n]))
+	}
+
+	// 恢复排空状态
+	_, err = testClientConnList[2].Write([]byte("SETDRAIN " + addr + " false"))
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = testClientConnList[2].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if sv.Draining() {
+		t.Errorf("server %s should not be draining", addr)
+	}
+}
+
+func TestProxyManagerCmdServerGroup(t *testing.T) {
+	buf := make([]byte, ReadBufSize)
+	var addr string
+	for a := range testProxy.serverGroup.ServerMap() {
+		addr = a
+		break
+	}
+
+	// 显式指定默认服务器组
+	_, err := testClientConnList[3].Write([]byte("EXISTS @" + config.DefaultGroupName + " " + addr))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err := testClientConnList[3].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != string(ServerExistsReply) {
+		t.Errorf("'EXISTS' command response is not correct, expect:%s, actual:%s", string(ServerExistsReply), string(buf[:n]))
+	}
+
+	// 指定不存在的服务器组
+	_, err = testClientConnList[3].Write([]byte("ADDSERVER @unknown 127.0.0.1:1"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err = testClientConnList[3].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(buf[:n]) != sysPrint.ErrGroupNotExists.Error() {
+		t.Errorf("'ADDSERVER' command response is not correct, expect:%s, actual:%s", sysPrint.ErrGroupNotExists.Error(), string(buf[:n]))
+	}
+}
+
+func TestProxyManagerCmdSetSplit(t *testing.T) {
+	buf := make([]byte, ReadBufSize)
+	testProxy.initServerGroup("canary", testProxy.config.LoadBalancerType, nil)
+	routes := []config.RouteConfig{{
+		Name: "split-test",
+		Host: "split.test",
+		Split: &config.SplitConfig{
+			Groups: []config.SplitGroupConfig{{Group: config.DefaultGroupName, Weight: 95}, {Group: "canary", Weight: 5}},
+		},
+	}}
+	rtr, err := newRouter(routes, testProxy.serverGroups, testProxy.config.HashKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRouter, oldRoutes := testProxy.router, testProxy.config.Routes
+	testProxy.router, testProxy.config.Routes = rtr, routes
+	defer func() {
+		testProxy.router, testProxy.config.Routes = oldRouter, oldRoutes
+		delete(testProxy.serverGroups, "canary")
+	}()
+
+	tests := []struct {
+		cmd    string
+		expect string
+	}{
+		{"SETSPLIT split-test " + config.DefaultGroupName + ":0 canary:100", string(ReplyOK)},
+		{"SETSPLIT split-test canary:abc", errSyntaxErr},
+		{"SETSPLIT split-test unknown:100", sysPrint.ErrGroupNotExists.Error()},
+		{"SETSPLIT split-test canary:0", sysPrint.ErrSplitWeightInvalid.Error()},
+		{"SETSPLIT unknown canary:100", sysPrint.ErrRouteNotExists.Error()},
+		{"SETSPLIT split-test", errWrongNumberArgs},
+	}
+	for _, tt := range tests {
+		_, err = testClientConnList[4].Write([]byte(tt.cmd))
+		if err != nil {
+			t.Error(err)
+		}
+		n, err := testClientConnList[4].Read(buf)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(buf[:n]) != tt.expect {
+			t.Errorf("'%s' command response is not correct, expect:%s, actual:%s", tt.cmd, tt.expect, string(buf[:n]))
+		}
+	}
+
+	// 所有流量切换到 canary，配置同步更新
+	req := httptest.NewRequest(http.MethodGet, "http://split.test/", nil)
+	if sg := testProxy.route(req).serverGroup(req); sg.Name() != "canary" {
+		t.Errorf("request should be routed to canary, actual:%s", sg.Name())
+	}
+	if w := testProxy.config.Routes[0].Split.Groups; len(w) != 2 || w[1].Weight != 100 {
+		t.Errorf("split config is not updated, actual:%v", w)
+	}
+}
+
+func TestProxyManagerCmdUrlPath(t *testing.T) {
+	buf := make([]byte, ReadBufSize)
+	tests := []struct {
+		cmd    string
+		expect string
+	}{
+		{"ADDPATH /path-test/:id", string(ReplyOK)},
+		{"ADDPATH /path-test/:id", sysPrint.ErrUrlPathExists.Error()},
+		{"ADDPATH /path-api*", string(ReplyOK)},
+		{"ADDPATH /path-api", string(ReplyOK)},
+		{"ADDPATH /path-test/**a/b", sysPrint.ErrPathPatternInvalid.Error()},
+		{"ADDPATH", errWrongNumberArgs},
+		{"DELETEPATH /path-api*", string(ReplyOK)},
+		{"DELETEPATH /path-api*", sysPrint.ErrUrlPathNotExists.Error()},
+		{"LISTPATHS extra", errWrongNumberArgs},
+	}
+	for _, tt := range tests {
+		_, err := testClientConnList[5].Write([]byte(tt.cmd))
+		if err != nil {
+			t.Error(err)
+		}
+		n, err := testClientConnList[5].Read(buf)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(buf[:n]) != tt.expect {
+			t.Errorf("'%s' command response is not correct, expect:%s, actual:%s", tt.cmd, tt.expect, string(buf[:n]))
+		}
+	}
+
+	// 删除 /path-api* 后，单独添加的 /path-api 仍然有效
+	matchTests := []struct {
+		path   string
+		expect bool
+	}{
+		{"/path-test/1", true},
+		{"/path-test/1/2", false},
+		{"/path-api", true},
+		{"/path-api/users", false},
+	}
+	for _, tt := range matchTests {
+		if testProxy.MatchUrlPath(tt.path) != tt.expect {
+			t.Errorf("match url path error, path:%s, expect:%v", tt.path, tt.expect)
+		}
+	}
+
+	_, err := testClientConnList[5].Write([]byte("LISTPATHS"))
+	if err != nil {
+		t.Error(err)
+	}
+	n, err := testClientConnList[5].Read(buf)
+	if err != nil {
+		t.Error(err)
+	}
+	listed := make(map[string]bool)
+	for _, path := range strings.Split(string(buf[:n]), "\n") {
+		listed[path] = true
+	}
+	if !listed["/path-test/:id"] || !listed["/path-api"] || listed["/path-api*"] {
+		t.Errorf("'LISTPATHS' command response is not correct, actual:%s", string(buf[:n]))
+	}
+
+	for _, path := range []string{"/path-test/:id", "/path-api"} {
+		err = testProxy.DeleteUrlPath(path)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if testProxy.MatchUrlPath("/path-test/1") {
+		t.Error("deleted url path should not be matched")
+	}
 }
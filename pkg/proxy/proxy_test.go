@@ -1,11 +1,19 @@
 package proxy
 
 import (
+	"EH-Proxy/config"
 	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"io"
 	"log"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -84,6 +92,8 @@ func TestProxy_Serve(t *testing.T) {
 			testProxyIsServing = true
 			testProxyServeMu.Unlock()
 			testProxy.Serve()
+		} else {
+			testProxyServeMu.Unlock()
 		}
 	}()
 	wg.Wait()
@@ -167,3 +177,1076 @@ func TestProxyHealthCheck(t *testing.T) {
 	}
 
 }
+
+func TestProxyStickySession(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		testProxyServeMu.Lock()
+		wg.Done()
+		if !testProxyIsServing {
+			testProxyIsServing = true
+			testProxyServeMu.Unlock()
+			testProxy.Serve()
+		} else {
+			testProxyServeMu.Unlock()
+		}
+	}()
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+
+	testProxy.config.StickySession.Enable = true
+	defer func() {
+		testProxy.config.StickySession.Enable = false
+	}()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	get := func() string {
+		resp, err := client.Get(HttpScheme + testProxy.config.Addr)
+		if err != nil {
+			t.Fatalf("request error:%v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read body error:%v", err)
+		}
+		return string(body)
+	}
+
+	// 携带 cookie 的后续请求总是转发给同一个服务器
+	first := get()
+	for i := 0; i < 20; i++ {
+		if body := get(); body != first {
+			t.Fatalf("sticky session error, expect:%s, actual:%s", first, body)
+		}
+	}
+
+	proxyURL, _ := url.Parse(HttpScheme + testProxy.config.Addr)
+	cookies := jar.Cookies(proxyURL)
+	if len(cookies) != 1 || cookies[0].Name != testProxy.config.StickySession.CookieName {
+		t.Fatalf("sticky cookie not set, cookies:%v", cookies)
+	}
+	addr := strings.TrimPrefix(first, "this is server:")
+	if strings.Contains(cookies[0].Value, addr) {
+		t.Errorf("sticky cookie exposes server address:%s", cookies[0].Value)
+	}
+
+	// 服务器主观下线时回退到负载均衡器选择
+	sv, err := testProxy.serverGroup.GetServer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	if testProxy.stickyServer(testProxy.serverGroup, req) != sv {
+		t.Errorf("sticky server error, expect:%s", addr)
+	}
+	sv.SetPfail(server.IS_PFAIL)
+	if s := testProxy.stickyServer(testProxy.serverGroup, req); s != nil {
+		t.Errorf("sticky server should be nil when pfail, actual:%s", s.Addr())
+	}
+	sv.SetPfail(server.NOT_PFAIL)
+
+	// 无效的 cookie 回退到负载均衡器选择，并重新设置 cookie
+	jar.SetCookies(proxyURL, []*http.Cookie{{Name: testProxy.config.StickySession.CookieName, Value: "invalid"}})
+	get()
+	cookies = jar.Cookies(proxyURL)
+	if len(cookies) != 1 || cookies[0].Value == "invalid" {
+		t.Errorf("sticky cookie not reset, cookies:%v", cookies)
+	}
+}
+
+func TestProxyStickySessionBackup(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+	primaryServer := newServer("primary")
+	defer primaryServer.Close()
+	backupServer := newServer("backup")
+	defer backupServer.Close()
+
+	sg := NewServerGroup("stickyBackup", testProxy.config.LoadBalancerType, nil)
+	for _, sc := range []config.ServerConfig{
+		{Addr: strings.TrimPrefix(primaryServer.URL, HttpScheme), Weight: serverWeight},
+		{Addr: strings.TrimPrefix(backupServer.URL, HttpScheme), Weight: serverWeight, Backup: true},
+	} {
+		if err := sg.AddServerWithConfig(testProxy, sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary, err := sg.GetServer(strings.TrimPrefix(primaryServer.URL, HttpScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRouter := testProxy.router
+	testProxy.router = &router{routes: []*route{{host: "sticky-backup.test", group: sg}}}
+	testProxy.config.StickySession.Enable = true
+	defer func() {
+		testProxy.router = oldRouter
+		testProxy.config.StickySession.Enable = false
+	}()
+
+	cookieName := testProxy.stickyCookieName(sg)
+	get := func(cookie *http.Cookie) (string, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "http://sticky-backup.test/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		HttpHandleRequest(w, req)
+		for _, c := range w.Result().Cookies() {
+			if c.Name == cookieName {
+				return w.Body.String(), c
+			}
+		}
+		return w.Body.String(), nil
+	}
+
+	// 主服务器下线时会话保持到备用服务器
+	primary.SetPfail(server.IS_PFAIL)
+	body, backupCookie := get(nil)
+	if body != "backup" || backupCookie == nil {
+		t.Fatalf("request should be forwarded to backup server, actual:%s, cookie:%v", body, backupCookie)
+	}
+	if body, _ = get(backupCookie); body != "backup" {
+		t.Errorf("sticky session error, expect:backup, actual:%s", body)
+	}
+
+	// 主服务器恢复后不再使用记录着备用服务器的 cookie，重新选择主服务器并更新 cookie
+	primary.SetPfail(server.NOT_PFAIL)
+	body, cookie := get(backupCookie)
+	if body != "primary" {
+		t.Errorf("sticky session should move back to primary server, actual:%s", body)
+	}
+	if cookie == nil || cookie.Value == backupCookie.Value {
+		t.Fatalf("sticky cookie not reset, cookie:%v", cookie)
+	}
+	for i := 0; i < 10; i++ {
+		if body, _ = get(cookie); body != "primary" {
+			t.Errorf("sticky session error, expect:primary, actual:%s", body)
+		}
+	}
+}
+
+func TestProxyConcurrencyLimit(t *testing.T) {
+	// 每个可用服务器的并发限制固定为 1
+	available := make([]*server.Server, 0)
+	for _, s := range testProxy.serverGroup.ServerMap() {
+		if s.Available() {
+			s.SetLimiter(server.NewLimiter(server.LimiterOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}))
+			available = append(available, s)
+		}
+	}
+	defer func() {
+		for _, s := range available {
+			s.SetLimiter(nil)
+		}
+	}()
+	if len(available) == 0 {
+		t.Skip("no available server")
+	}
+
+	// 选中的服务器达到并发限制时选择其他服务器，每个服务器只被占用一次
+	acquired := make(map[*server.Server]struct{})
+	for i := 0; i < len(available); i++ {
+		s := testProxy.acquireServer(testProxy.serverGroup, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if s == nil {
+			t.Fatalf("acquire server %d failed", i)
+		}
+		if _, ok := acquired[s]; ok {
+			t.Fatalf("server %s acquired twice", s.Addr())
+		}
+		acquired[s] = struct{}{}
+	}
+
+	// 所有服务器都达到并发限制时返回 503 和 Retry-After
+	w := httptest.NewRecorder()
+	HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code error, expect:%d, actual:%d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Retry-After header not set")
+	}
+
+	// 释放后可以再次占用
+	for s := range acquired {
+		s.Release(time.Millisecond, false)
+	}
+	s := testProxy.acquireServer(testProxy.serverGroup, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if s == nil {
+		t.Fatalf("acquire server failed after release")
+	}
+	s.Release(time.Millisecond, false)
+}
+
+func TestProxyConcurrencyLimitBackup(t *testing.T) {
+	var backupHits int32
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primaryServer.Close()
+	backupServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backupServer.Close()
+
+	sg := NewServerGroup("concurrencyBackup", testProxy.config.LoadBalancerType, nil)
+	for _, sc := range []config.ServerConfig{
+		{Addr: strings.TrimPrefix(primaryServer.URL, HttpScheme), Weight: serverWeight},
+		{Addr: strings.TrimPrefix(backupServer.URL, HttpScheme), Weight: serverWeight, Backup: true},
+	} {
+		if err := sg.AddServerWithConfig(testProxy, sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary, err := sg.GetServer(strings.TrimPrefix(primaryServer.URL, HttpScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRouter := testProxy.router
+	testProxy.router = &router{routes: []*route{{host: "concurrency-backup.test", group: sg}}}
+	defer func() {
+		testProxy.router = oldRouter
+	}()
+
+	// 主服务器达到并发限制时不会转而选择备用服务器，返回 503 和 Retry-After
+	primary.SetLimiter(server.NewLimiter(server.LimiterOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 1}))
+	if !primary.TryAcquire() {
+		t.Fatal("acquire primary server failed")
+	}
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, "http://concurrency-backup.test/", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status code error, expect:%d, actual:%d", http.StatusServiceUnavailable, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Fatalf("Retry-After header not set")
+		}
+	}
+	if hits := atomic.LoadInt32(&backupHits); hits != 0 {
+		t.Errorf("backup server should not receive requests, actual hits:%d", hits)
+	}
+
+	// 主服务器不可用时才使用备用服务器
+	primary.Release(time.Millisecond, false)
+	primary.SetPfail(server.IS_PFAIL)
+	w := httptest.NewRecorder()
+	HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, "http://concurrency-backup.test/", nil))
+	if w.Code != http.StatusOK || atomic.LoadInt32(&backupHits) != 1 {
+		t.Errorf("request should be forwarded to backup server, actual:%d, hits:%d", w.Code, atomic.LoadInt32(&backupHits))
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	groups := map[string]*ServerGroup{
+		"api":    NewServerGroup("api", testProxy.config.LoadBalancerType, nil),
+		"static": NewServerGroup("static", testProxy.config.LoadBalancerType, nil),
+		"ws":     NewServerGroup("ws", testProxy.config.LoadBalancerType, nil),
+		"tenant": NewServerGroup("tenant", testProxy.config.LoadBalancerType, nil),
+	}
+	rtr, err := newRouter([]config.RouteConfig{
+		{PathPrefix: "/static/", Group: "static"},
+		{Host: "*.example.com", Group: "tenant"},
+		{Host: "api.example.com", Group: "api"},
+		{Host: "api.example.com", PathPrefix: "/ws", Group: "ws"},
+	}, groups, HashKeyClientIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url   string
+		group string
+	}{
+		{"http://api.example.com/users", "api"},
+		{"http://API.example.com:8080/users", "api"},
+		{"http://api.example.com/ws/chat", "ws"},
+		{"http://api.example.com/ws", "ws"},
+		{"http://api.example.com/wsdl", "api"},
+		{"http://api.example.com/ws-docs/index.html", "api"},
+		{"http://a.example.com/static/logo.png", "tenant"},
+		{"http://example.com/static/logo.png", "static"},
+		{"http://other.com/static/logo.png", "static"},
+		{"http://other.com/index.html", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		rt := rtr.match(req)
+		name := ""
+		if rt != nil {
+			name = rt.serverGroup(req).Name()
+		}
+		if name != tt.group {
+			t.Errorf("route error, url:%s, expect:%s, actual:%s", tt.url, tt.group, name)
+		}
+	}
+
+	_, err = newRouter([]config.RouteConfig{{PathPrefix: "/", Group: "unknown"}}, groups, HashKeyClientIP)
+	if err != sysPrint.ErrGroupNotExists {
+		t.Errorf("expect ErrGroupNotExists, actual:%v", err)
+	}
+}
+
+func TestRouterMatchConditions(t *testing.T) {
+	groups := map[string]*ServerGroup{
+		"api":     NewServerGroup("api", testProxy.config.LoadBalancerType, nil),
+		"canary":  NewServerGroup("canary", testProxy.config.LoadBalancerType, nil),
+		"storage": NewServerGroup("storage", testProxy.config.LoadBalancerType, nil),
+		"v2":      NewServerGroup("v2", testProxy.config.LoadBalancerType, nil),
+		"debug":   NewServerGroup("debug", testProxy.config.LoadBalancerType, nil),
+	}
+	rtr, err := newRouter([]config.RouteConfig{
+		{PathPrefix: "/api", Group: "api"},
+		{Headers: []config.MatchConfig{{Name: "x-tenant", Exact: "beta"}}, Group: "canary"},
+		{Methods: []string{"post", "PUT"}, PathPrefix: "/upload", Group: "storage"},
+		{PathPrefix: "/api", Headers: []config.MatchConfig{{Name: "Accept", Prefix: "application/vnd.v2"}}, Group: "v2"},
+		{Query: []config.MatchConfig{{Name: "debug"}, {Name: "trace", Regex: "^[0-9]+$"}}, Group: "debug"},
+		{Path: "/users/:id<[0-9]+>/avatar", Group: "storage"},
+		{Path: "/ws*", Group: "v2"},
+	}, groups, HashKeyClientIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		url    string
+		header map[string]string
+		group  string
+	}{
+		{http.MethodGet, "http://example.com/api/users", nil, "api"},
+		{http.MethodGet, "http://example.com/api/users", map[string]string{"X-Tenant": "beta"}, "canary"},
+		{http.MethodGet, "http://example.com/api/users", map[string]string{"X-Tenant": "alpha"}, "api"},
+		{http.MethodGet, "http://example.com/api/users", map[string]string{"Accept": "application/vnd.v2+json"}, "v2"},
+		{http.MethodPost, "http://example.com/upload/a.png", nil, "storage"},
+		{http.MethodPut, "http://example.com/upload/a.png", nil, "storage"},
+		{http.MethodGet, "http://example.com/upload/a.png", nil, ""},
+		{http.MethodGet, "http://example.com/?debug&trace=123", nil, "debug"},
+		{http.MethodGet, "http://example.com/?debug=1&trace=abc", nil, ""},
+		{http.MethodGet, "http://example.com/?trace=123", nil, ""},
+		{http.MethodGet, "http://example.com/users/42/avatar", nil, "storage"},
+		{http.MethodGet, "http://example.com/users/alice/avatar", nil, ""},
+		{http.MethodGet, "http://example.com/ws", nil, "v2"},
+		{http.MethodGet, "http://example.com/ws/chat", nil, "v2"},
+		{http.MethodGet, "http://example.com/wsx", nil, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rt := rtr.match(req)
+		name := ""
+		if rt != nil {
+			name = rt.serverGroup(req).Name()
+		}
+		if name != tt.group {
+			t.Errorf("route error, %s %s %v, expect:%s, actual:%s", tt.method, tt.url, tt.header, tt.group, name)
+		}
+	}
+
+	_, err = newRouter([]config.RouteConfig{{Headers: []config.MatchConfig{{Name: "X-Tenant", Exact: "beta", Prefix: "b"}}, Group: "canary"}}, groups, HashKeyClientIP)
+	if err != sysPrint.ErrMatchConditionInvalid {
+		t.Errorf("expect ErrMatchConditionInvalid, actual:%v", err)
+	}
+	_, err = newRouter([]config.RouteConfig{{Query: []config.MatchConfig{{Name: "trace", Regex: "("}}, Group: "debug"}}, groups, HashKeyClientIP)
+	if err == nil {
+		t.Error("invalid regex should fail")
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	tests := []struct {
+		rewrite config.RewriteConfig
+		url     string
+		path    string
+		host    string
+	}{
+		{config.RewriteConfig{StripPrefix: "/api/v1"}, "http://example.com/api/v1/users", "/users", "example.com"},
+		{config.RewriteConfig{StripPrefix: "/api/v1"}, "http://example.com/api/v1", "/", "example.com"},
+		{config.RewriteConfig{StripPrefix: "/api/v1"}, "http://example.com/static/a.png", "/static/a.png", "example.com"},
+		{config.RewriteConfig{StripPrefix: "/api/v1"}, "http://example.com/api/v1users", "/api/v1users", "example.com"},
+		{config.RewriteConfig{AddPrefix: "/backend/"}, "http://example.com/users", "/backend/users", "example.com"},
+		{config.RewriteConfig{StripPrefix: "/api", AddPrefix: "/v2"}, "http://example.com/api/users", "/v2/users", "example.com"},
+		{config.RewriteConfig{Regex: "^/users/([0-9]+)/profile$", Replacement: "/profiles/$1"}, "http://example.com/users/42/profile", "/profiles/42", "example.com"},
+		{config.RewriteConfig{Regex: "^/(?P<lang>[a-z]{2})/(.*)$", Replacement: "/${2}"}, "http://example.com/en/docs/intro", "/docs/intro", "example.com"},
+		{config.RewriteConfig{Host: "backend.internal"}, "http://example.com/users", "/users", "backend.internal"},
+		{config.RewriteConfig{UpstreamHost: true}, "http://example.com/users", "/users", "127.0.0.1:8080"},
+	}
+	for _, tt := range tests {
+		rw, err := newRewriter(tt.rewrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		rw.apply(req, "127.0.0.1:8080")
+		if req.URL.Path != tt.path || req.Host != tt.host {
+			t.Errorf("rewrite error, url:%s, expect:%s %s, actual:%s %s", tt.url, tt.host, tt.path, req.Host, req.URL.Path)
+		}
+	}
+
+	// 转义字符原样转发
+	rw, err := newRewriter(config.RewriteConfig{StripPrefix: "/api/v1", AddPrefix: "/v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/v1/files/a%2Fb%20c", nil)
+	rw.apply(req, "127.0.0.1:8080")
+	if req.URL.EscapedPath() != "/v2/files/a%2Fb%20c" || req.URL.Path != "/v2/files/a/b c" {
+		t.Errorf("escaped path should be kept, actual:%s %s", req.URL.EscapedPath(), req.URL.Path)
+	}
+
+	rw, err = newRewriter(config.RewriteConfig{})
+	if rw != nil || err != nil {
+		t.Errorf("empty rewrite config should return nil, actual:%v, %v", rw, err)
+	}
+	_, err = newRewriter(config.RewriteConfig{Regex: "("})
+	if err == nil {
+		t.Error("invalid regex should fail")
+	}
+}
+
+func TestTrafficSplit(t *testing.T) {
+	groups := map[string]*ServerGroup{
+		"stable": NewServerGroup("stable", testProxy.config.LoadBalancerType, nil),
+		"canary": NewServerGroup("canary", testProxy.config.LoadBalancerType, nil),
+	}
+	ts, err := newTrafficSplit(&config.SplitConfig{
+		Groups:   []config.SplitGroupConfig{{Group: "stable", Weight: 95}, {Group: "canary", Weight: 5}},
+		Override: "header:X-Variant",
+	}, groups, HashKeyClientIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const clientNum = 20000
+	newRequest := func(i int) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10." + strconv.Itoa(i>>16&0xff) + "." + strconv.Itoa(i>>8&0xff) + "." + strconv.Itoa(i&0xff) + ":1234"
+		return req
+	}
+	canaryClients := make(map[int]struct{})
+	for i := 0; i < clientNum; i++ {
+		req := newRequest(i)
+		sg := ts.selectGroup(req)
+		if sg != ts.selectGroup(req) {
+			t.Fatalf("the same client should always be assigned to the same group, client:%s", req.RemoteAddr)
+		}
+		if sg == groups["canary"] {
+			canaryClients[i] = struct{}{}
+		}
+	}
+	actual := float64(len(canaryClients)) / clientNum
+	if actual < 0.04 || actual > 0.06 {
+		t.Errorf("canary ratio error, expect:0.05, actual:%.3f", actual)
+	}
+
+	// 增加灰度比例后，原来分配到灰度服务器组的客户端仍然分配到灰度服务器组
+	err = ts.update([]config.SplitGroupConfig{{Group: "stable", Weight: 90}, {Group: "canary", Weight: 10}}, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range canaryClients {
+		if ts.selectGroup(newRequest(i)) != groups["canary"] {
+			t.Fatalf("client should stay in canary after increasing the canary weight, client:%d", i)
+		}
+	}
+
+	// 通过请求头强制指定服务器组，不在分流表中的服务器组无效
+	req := newRequest(0)
+	req.Header.Set("X-Variant", "canary")
+	if ts.selectGroup(req) != groups["canary"] {
+		t.Error("override header should force the canary group")
+	}
+	err = ts.update([]config.SplitGroupConfig{{Group: "stable", Weight: 100}, {Group: "canary", Weight: 0}}, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.selectGroup(req) != groups["canary"] {
+		t.Error("override header should force the canary group even if its weight is 0")
+	}
+	req.Header.Set("X-Variant", "unknown")
+	if ts.selectGroup(req) != groups["stable"] {
+		t.Error("unknown override value should be ignored")
+	}
+
+	err = ts.update([]config.SplitGroupConfig{{Group: "stable", Weight: 0}}, groups)
+	if err != sysPrint.ErrSplitWeightInvalid {
+		t.Errorf("expect ErrSplitWeightInvalid, actual:%v", err)
+	}
+	err = ts.update([]config.SplitGroupConfig{{Group: "unknown", Weight: 10}}, groups)
+	if err != sysPrint.ErrGroupNotExists {
+		t.Errorf("expect ErrGroupNotExists, actual:%v", err)
+	}
+}
+
+func TestProxyMirror(t *testing.T) {
+	received := make(chan string, 10)
+	release := make(chan struct{})
+	shadowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Method + " " + r.URL.Path + " " + string(body)
+		<-release // 影子服务器响应很慢
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadowServer.Close()
+	defer close(release)
+
+	shadow := NewServerGroup("shadow", testProxy.config.LoadBalancerType, nil)
+	err := shadow.AddServer(testProxy, strings.TrimPrefix(shadowServer.URL, HttpScheme), serverWeight, server.NoHealthCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw, err := newRewriter(config.RewriteConfig{StripPrefix: "/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &route{group: testProxy.serverGroup, rewrite: rw, mirror: &mirror{group: shadow, percent: 100}}
+
+	// 镜像请求在后台发送，不阻塞原请求，原请求的请求体保持完整
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("hello"))
+	start := time.Now()
+	testProxy.mirrorRequest(rt, req)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("mirror should not block the request, elapsed:%v", elapsed)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("request body is changed, actual:%s, %v", string(body), err)
+	}
+	select {
+	case actual := <-received:
+		if actual != "POST /upload hello" {
+			t.Errorf("mirror request error, expect:POST /upload hello, actual:%s", actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shadow server did not receive the mirror request")
+	}
+
+	// 请求体超过大小上限时不镜像，原请求的请求体保持完整
+	maxBodySize := testProxy.config.Mirror.MaxBodySize
+	testProxy.config.Mirror.MaxBodySize = 4
+	defer func() {
+		testProxy.config.Mirror.MaxBodySize = maxBodySize
+	}()
+	req = httptest.NewRequest(http.MethodPost, "/api/upload", io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")))
+	req.ContentLength = -1
+	testProxy.mirrorRequest(rt, req)
+	body, err = io.ReadAll(req.Body)
+	if err != nil || string(body) != "hello world" {
+		t.Errorf("request body is changed, actual:%s, %v", string(body), err)
+	}
+	select {
+	case actual := <-received:
+		t.Errorf("request with large body should not be mirrored, actual:%s", actual)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestUrlPathCheck(t *testing.T) {
+	paths := map[string]*config.UrlPathResponseConfig{
+		"/api*":          nil,
+		"/api/internal*": {Status: http.StatusNotFound},
+		"/old/*":         {Location: "/new"},
+	}
+	tests := []struct {
+		mode     string
+		path     string
+		status   int // 为 0 时允许转发
+		location string
+	}{
+		{config.UrlPathCheckAllow, "/api/users", 0, ""},
+		{config.UrlPathCheckAllow, "/apiary", http.StatusForbidden, ""},
+		{config.UrlPathCheckAllow, "/api/internal/metrics", http.StatusNotFound, ""},
+		{config.UrlPathCheckAllow, "/old/page", http.StatusFound, "/new"},
+		{config.UrlPathCheckDeny, "/api/users", http.StatusForbidden, ""},
+		{config.UrlPathCheckDeny, "/apiary", 0, ""},
+		{config.UrlPathCheckDeny, "/api/internal", http.StatusNotFound, ""},
+		{config.UrlPathCheckDeny, "/old/page", http.StatusFound, "/new"},
+	}
+	for _, tt := range tests {
+		p := &proxy{config: &config.ProxyConfig{
+			UrlPathCheckMode:     tt.mode,
+			UrlPathCheckResponse: config.UrlPathResponseConfig{Status: http.StatusForbidden},
+			UrlPathMap:           paths,
+		}}
+		p.initUrlPaths()
+		resp := p.checkUrlPath(tt.path)
+		if tt.status == 0 {
+			if resp != nil {
+				t.Errorf("mode:%s, path:%s should be allowed, actual status:%d", tt.mode, tt.path, resp.status)
+			}
+			continue
+		}
+		if resp == nil || resp.status != tt.status || resp.location != tt.location {
+			t.Errorf("mode:%s, path:%s, expect status:%d, location:%s, actual:%+v", tt.mode, tt.path, tt.status, tt.location, resp)
+		}
+	}
+
+	// 默认响应为 400 "Invalid URL path."，无效的响应配置被忽略，路径仍然有效
+	p := &proxy{config: &config.ProxyConfig{
+		UrlPathMap: map[string]*config.UrlPathResponseConfig{"/a": {Status: 700}, "/b": {Status: 200, Location: "/c"}},
+	}}
+	p.initUrlPaths()
+	if resp := p.checkUrlPath("/a"); resp != nil {
+		t.Errorf("path with invalid response should be allowed, actual status:%d", resp.status)
+	}
+	if resp := p.checkUrlPath("/x"); resp == nil || resp.status != http.StatusBadRequest || string(resp.body) != string(invalidURLPath) {
+		t.Errorf("default response error, actual:%+v", resp)
+	}
+
+	// 多个路径转换出相同的模式时，与模式完全相同的路径优先，其次是 /x/* 形式的路径，结果与 map 遍历顺序无关
+	p = &proxy{config: &config.ProxyConfig{
+		UrlPathCheckMode: config.UrlPathCheckDeny,
+		UrlPathMap: map[string]*config.UrlPathResponseConfig{
+			"/api":     {Status: http.StatusForbidden},
+			"/api*":    {Location: "/login"},
+			"/v1/*":    {Status: http.StatusNotFound},
+			"/v1*":     {Status: http.StatusGone},
+			"/v1/**":   nil,
+			"/static*": {Status: http.StatusNotFound},
+		},
+	}}
+	conflicts := []struct {
+		path   string
+		status int
+	}{
+		{"/api", http.StatusForbidden},
+		{"/api/users", http.StatusFound},
+		{"/v1", http.StatusGone},
+		{"/v1/users", http.StatusBadRequest},
+		{"/static/app.js", http.StatusNotFound},
+	}
+	for i := 0; i < 20; i++ {
+		p.initUrlPaths()
+		for _, tt := range conflicts {
+			if resp := p.checkUrlPath(tt.path); resp == nil || resp.status != tt.status {
+				t.Fatalf("path:%s, expect status:%d, actual:%+v", tt.path, tt.status, resp)
+			}
+		}
+	}
+
+	// 删除优先级更高的路径后，由剩余的路径决定模式的响应
+	if err := p.DeleteUrlPath("/v1/**"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := p.checkUrlPath("/v1/users"); resp == nil || resp.status != http.StatusNotFound {
+		t.Errorf("path:/v1/users, expect status:%d, actual:%+v", http.StatusNotFound, resp)
+	}
+	if err := p.DeleteUrlPath("/v1/*"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := p.checkUrlPath("/v1/users"); resp == nil || resp.status != http.StatusGone {
+		t.Errorf("path:/v1/users, expect status:%d, actual:%+v", http.StatusGone, resp)
+	}
+}
+
+func TestProxyUrlPathDeny(t *testing.T) {
+	oldTable, oldOption, oldMap := testProxy.urlPathTable(), testProxy.config.UrlPathCheckOption, testProxy.config.UrlPathMap
+	testProxy.config.UrlPathCheckOption = true
+	testProxy.config.UrlPathCheckMode = config.UrlPathCheckDeny
+	testProxy.config.UrlPathMap = map[string]*config.UrlPathResponseConfig{
+		"/admin*": nil,
+		"/.git*":  {Status: http.StatusNotFound, Body: "not found"},
+	}
+	testProxy.initUrlPaths()
+	defer func() {
+		testProxy.config.UrlPathCheckOption, testProxy.config.UrlPathMap = oldOption, oldMap
+		testProxy.config.UrlPathCheckMode = ""
+		testProxy.urlPaths.Store(oldTable)
+	}()
+
+	// 被拒绝的请求不转发给服务器
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/admin", http.StatusBadRequest, string(invalidURLPath)},
+		{"/admin/users", http.StatusBadRequest, string(invalidURLPath)},
+		{"/.git/config", http.StatusNotFound, "not found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("path:%s, expect:%d %s, actual:%d %s", tt.path, tt.status, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, "/administrator", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "this is server:") {
+		t.Errorf("request should be forwarded, actual:%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestProxyRetry(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	newServer := func(name string, handler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+			handler(w, r)
+		}))
+	}
+	unavailableServer := newServer("unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer unavailableServer.Close()
+	slowServer := newServer("slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	defer slowServer.Close()
+	goodServer := newServer("good", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("ok " + string(body)))
+	})
+	defer goodServer.Close()
+	deadServer := httptest.NewServer(http.NotFoundHandler())
+	deadServer.Close() // 连接失败
+
+	sg := NewServerGroup("retry", testProxy.config.LoadBalancerType, nil)
+	for _, ts := range []*httptest.Server{unavailableServer, slowServer, goodServer, deadServer} {
+		err := sg.AddServer(testProxy, strings.TrimPrefix(ts.URL, HttpScheme), serverWeight, server.NoHealthCheck)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rtr := &router{routes: []*route{{host: "retry.test", group: sg}}}
+	oldRouter, oldRetry := testProxy.router, testProxy.retry
+	testProxy.router = rtr
+	testProxy.retry = newRetryPolicy(config.RetryConfig{Enable: true, MaxAttempts: 4, PerTryTimeout: 100 * time.Millisecond})
+	defer func() {
+		testProxy.router, testProxy.retry = oldRouter, oldRetry
+	}()
+
+	// 失败的尝试换到其他服务器重试，每个服务器至多尝试一次，请求体在重试时保持完整
+	for i := 0; i < 8; i++ {
+		w := httptest.NewRecorder()
+		HttpHandleRequest(w, httptest.NewRequest(http.MethodPut, "http://retry.test/", strings.NewReader("body")))
+		if w.Code != http.StatusOK || w.Body.String() != "ok body" {
+			t.Errorf("request should be retried until success, actual:%d %s", w.Code, w.Body.String())
+		}
+	}
+	if hits["good"] != 8 || hits["unavailable"] > 8 || hits["slow"] > 8 {
+		t.Errorf("server hits error, actual:%v", hits)
+	}
+
+	// 非幂等方法默认不重试
+	failed := 0
+	for i := 0; i < 8; i++ {
+		w := httptest.NewRecorder()
+		HttpHandleRequest(w, httptest.NewRequest(http.MethodPost, "http://retry.test/", strings.NewReader("body")))
+		if w.Code != http.StatusOK {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Errorf("POST request should not be retried")
+	}
+}
+
+func TestProxyRetrySingleServer(t *testing.T) {
+	var hits int32
+	unavailableServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("maintenance"))
+	}))
+	defer unavailableServer.Close()
+
+	sg := NewServerGroup("retrySingle", testProxy.config.LoadBalancerType, nil)
+	err := sg.AddServer(testProxy, strings.TrimPrefix(unavailableServer.URL, HttpScheme), serverWeight, server.NoHealthCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRouter, oldRetry := testProxy.router, testProxy.retry
+	testProxy.router = &router{routes: []*route{{host: "retry-single.test", group: sg}}}
+	testProxy.retry = newRetryPolicy(config.RetryConfig{Enable: true, MaxAttempts: 3})
+	defer func() {
+		testProxy.router, testProxy.retry = oldRouter, oldRetry
+	}()
+
+	// 没有其他可选的服务器时返回服务器的原始响应
+	w := httptest.NewRecorder()
+	HttpHandleRequest(w, httptest.NewRequest(http.MethodGet, "http://retry-single.test/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "maintenance" || w.Header().Get("Retry-After") != "5" {
+		t.Errorf("response of the last attempt should be returned, actual:%d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("server hits error, expect:1, actual:%d", n)
+	}
+}
+
+func TestServerBreaker(t *testing.T) {
+	s, err := server.NewServer("127.0.0.1:50001", serverWeight, server.NoHealthCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetBreaker(server.NewBreaker(server.BreakerOptions{ConsecutiveFailures: 3, OpenDuration: 50 * time.Millisecond, HalfOpenRequests: 2}))
+	request := func(failed bool) bool {
+		if !s.TryAcquire() {
+			return false
+		}
+		s.ReleaseResult(time.Millisecond, false, failed)
+		return true
+	}
+
+	// 连续失败次数达到阈值时打开，成功的请求重置连续失败次数
+	for _, failed := range []bool{true, true, false, true, true} {
+		request(failed)
+	}
+	if s.BreakerState() != server.BreakerClosed {
+		t.Fatalf("breaker should be closed, actual:%s", s.BreakerState())
+	}
+	request(true)
+	if s.BreakerState() != server.BreakerOpen || s.Available() || s.TryAcquire() {
+		t.Fatalf("breaker should be open, actual:%s", s.BreakerState())
+	}
+
+	// 打开 open-duration 后进入半开状态，只放行 half-open-requests 个试探请求，试探请求失败则重新打开
+	time.Sleep(100 * time.Millisecond)
+	if s.BreakerState() != server.BreakerHalfOpen || !s.Available() {
+		t.Fatalf("breaker should be half-open, actual:%s", s.BreakerState())
+	}
+	if !s.TryAcquire() || !s.TryAcquire() || s.TryAcquire() {
+		t.Fatal("half-open breaker should allow 2 trial requests")
+	}
+	s.ReleaseResult(time.Millisecond, false, true)
+	s.ReleaseResult(time.Millisecond, false, false) // 打开状态下完成的请求不计入
+	if s.BreakerState() != server.BreakerOpen {
+		t.Fatalf("breaker should be reopened, actual:%s", s.BreakerState())
+	}
+
+	// 所有试探请求成功后关闭
+	time.Sleep(100 * time.Millisecond)
+	if !request(false) || s.BreakerState() != server.BreakerHalfOpen {
+		t.Fatalf("breaker should be half-open after 1 successful trial, actual:%s", s.BreakerState())
+	}
+	if !request(false) || s.BreakerState() != server.BreakerClosed {
+		t.Fatalf("breaker should be closed, actual:%s", s.BreakerState())
+	}
+	if s.ActiveReq() != 0 {
+		t.Errorf("active requests error, expect:0, actual:%d", s.ActiveReq())
+	}
+
+	// 按时间窗口内的失败率打开
+	rateServer, err := server.NewServer("127.0.0.1:50002", serverWeight, server.NoHealthCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateServer.SetBreaker(server.NewBreaker(server.BreakerOptions{FailureRate: 0.5, MinRequests: 10}))
+	for i := 0; i < 9; i++ {
+		if rateServer.TryAcquire() {
+			rateServer.ReleaseResult(time.Millisecond, false, i%2 == 0)
+		}
+	}
+	if rateServer.BreakerState() != server.BreakerClosed {
+		t.Fatalf("breaker should be closed before min requests, actual:%s", rateServer.BreakerState())
+	}
+	rateServer.TryAcquire()
+	rateServer.ReleaseResult(time.Millisecond, false, false)
+	if rateServer.BreakerState() != server.BreakerOpen {
+		t.Fatalf("breaker should be open when failure rate reaches 0.5, actual:%s", rateServer.BreakerState())
+	}
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	var failedHits int32
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failedHits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer goodServer.Close()
+
+	// 开启断路器后添加的服务器使用各自的断路器
+	oldOption, oldBreaker := testProxy.config.CircuitBreakerOption, testProxy.config.CircuitBreaker
+	testProxy.config.CircuitBreakerOption = true
+	testProxy.config.CircuitBreaker = config.CircuitBreakerConfig{ConsecutiveFailures: 2, OpenDuration: time.Hour}
+	sg := NewServerGroup("breaker", testProxy.config.LoadBalancerType, nil)
+	for _, ts := range []*httptest.Server{failingServer, goodServer} {
+		err := sg.AddServer(testProxy, strings.TrimPrefix(ts.URL, HttpScheme), serverWeight, server.NoHealthCheck)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRouter := testProxy.router
+	testProxy.router = &router{routes: []*route{{host: "breaker.test", group: sg}}}
+	defer func() {
+		testProxy.router = oldRouter
+		testProxy.config.CircuitBreakerOption, testProxy.config.CircuitBreaker = oldOption, oldBreaker
+	}()
+
+	// 5xx 响应计为失败，断路器打开后服务器不再被选择
+	for i := 0; i < 20; i++ {
+		HttpHandleRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://breaker.test/", nil))
+	}
+	if hits := atomic.LoadInt32(&failedHits); hits != 2 {
+		t.Errorf("failing server hits error, expect:2, actual:%d", hits)
+	}
+	s, err := sg.GetServer(strings.TrimPrefix(failingServer.URL, HttpScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := strings.Builder{}
+	writeServerInfo(&builder, s)
+	if !strings.Contains(builder.String(), "circuit breaker: open\n") {
+		t.Errorf("server info should contain breaker state, actual:%s", builder.String())
+	}
+}
+
+func TestOutlierDetection(t *testing.T) {
+	var failedHits int32
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failedHits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failingServer.Close()
+	goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer goodServer.Close()
+
+	sg := NewServerGroup("outlier", testProxy.config.LoadBalancerType, nil)
+	for _, ts := range []*httptest.Server{failingServer, goodServer} {
+		err := sg.AddServer(testProxy, strings.TrimPrefix(ts.URL, HttpScheme), serverWeight, server.NoHealthCheck)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sg.outlier = newOutlierDetector(sg, config.OutlierDetectionConfig{
+		Enable:             true,
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   200 * time.Millisecond,
+		MaxEjectionTime:    time.Second,
+		MaxEjectionPercent: 50,
+	})
+	oldRouter := testProxy.router
+	testProxy.router = &router{routes: []*route{{host: "outlier.test", group: sg}}}
+	defer func() { testProxy.router = oldRouter }()
+
+	// 连续 3 次错误后服务器被驱逐，不再被选择
+	for i := 0; i < 20; i++ {
+		HttpHandleRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://outlier.test/", nil))
+	}
+	if hits := atomic.LoadInt32(&failedHits); hits != 3 {
+		t.Errorf("failing server hits error, expect:3, actual:%d", hits)
+	}
+	failing, err := sg.GetServer(strings.TrimPrefix(failingServer.URL, HttpScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := sg.GetServer(strings.TrimPrefix(goodServer.URL, HttpScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failing.Ejected() {
+		t.Fatal("failing server should be ejected")
+	}
+	builder := strings.Builder{}
+	writeServerInfo(&builder, failing)
+	if !strings.Contains(builder.String(), "ejected:"+trueString+"\n") {
+		t.Errorf("server info should contain ejection state, actual:%s", builder.String())
+	}
+
+	// 被驱逐的服务器数达到上限（2 个服务器的 50%）时不再驱逐
+	st := sg.outlier.statsOf(good)
+	sg.outlier.lock.Lock()
+	ok := sg.outlier.eject(good, st, "test")
+	sg.outlier.lock.Unlock()
+	if ok || good.Ejected() {
+		t.Error("ejected servers should not exceed max-ejection-percent")
+	}
+
+	// 组内最后一个可用的服务器不会被驱逐
+	single := NewServerGroup("outlierSingle", testProxy.config.LoadBalancerType, nil)
+	err = single.AddServer(testProxy, "127.0.0.1:19200", serverWeight, server.NoHealthCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lone, _ := single.GetServer("127.0.0.1:19200")
+	d := newOutlierDetector(single, config.OutlierDetectionConfig{Enable: true, ConsecutiveErrors: 3, MaxEjectionPercent: 100})
+	for i := 0; i < 10; i++ {
+		d.onResult(lone, true)
+	}
+	if lone.Ejected() {
+		t.Error("the last available server should not be ejected")
+	}
+
+	// 驱逐到期后自动恢复，再次驱逐的时长加倍
+	time.Sleep(300 * time.Millisecond)
+	if failing.Ejected() {
+		t.Fatal("failing server should be back after ejection time")
+	}
+	for i := 0; i < 10; i++ {
+		HttpHandleRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://outlier.test/", nil))
+	}
+	if !failing.Ejected() {
+		t.Fatal("failing server should be ejected again")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if !failing.Ejected() {
+		t.Error("second ejection should last twice as long")
+	}
+}
+
+func TestOutlierDetectionErrorRate(t *testing.T) {
+	sg := NewServerGroup("outlierRate", testProxy.config.LoadBalancerType, nil)
+	servers := make([]*server.Server, 4)
+	for i := range servers {
+		addr := "127.0.0.1:" + strconv.Itoa(19100+i)
+		err := sg.AddServer(testProxy, addr, serverWeight, server.NoHealthCheck)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i], _ = sg.GetServer(addr)
+	}
+	d := newOutlierDetector(sg, config.OutlierDetectionConfig{
+		Enable:            true,
+		ConsecutiveErrors: 100,
+		MinRequests:       10,
+		BaseEjectionTime:  time.Hour,
+	})
+
+	// 服务器 0 的错误率为 50%，其余服务器为 0~10%，平均错误率的 2 倍约为 35%
+	for i, s := range servers {
+		for j := 0; j < 20; j++ {
+			d.onResult(s, (i == 0 && j%2 == 0) || (i > 0 && j < i-1))
+		}
+	}
+	d.detect()
+	for i, s := range servers {
+		if s.Ejected() != (i == 0) {
+			t.Errorf("server %d ejected error, expect:%v, actual:%v", i, i == 0, s.Ejected())
+		}
+	}
+
+	// 统计数据在每个周期重置，请求数不足时不计算错误率
+	d.detect()
+	for _, s := range servers[1:] {
+		if s.Ejected() {
+			t.Errorf("server %s should not be ejected", s.Addr())
+		}
+	}
+}
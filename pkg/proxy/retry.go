@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/server"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// defaultRetryStatusCodes 默认需要重试的响应状态码
+	defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+	// defaultRetryMethods 默认可以重试的请求方法（幂等方法）
+	defaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace}
+)
+
+// retryPolicy 请求重试策略
+type retryPolicy struct {
+	maxAttempts   int                 // 最大尝试次数（包括首次请求）
+	perTryTimeout time.Duration       // 每次尝试的超时时间，为 0 时不限制
+	statusCodes   map[int]struct{}    // 需要重试的响应状态码
+	methods       map[string]struct{} // 可以重试的请求方法（大写）
+	maxBodySize   int64               // 可重试请求的请求体大小上限
+}
+
+// newRetryPolicy 根据重试配置创建重试策略，未开启重试或最大尝试次数为 1 时返回 nil
+func newRetryPolicy(rc config.RetryConfig) *retryPolicy {
+	if !rc.Enable {
+		return nil
+	}
+	rp := &retryPolicy{
+		maxAttempts:   rc.MaxAttempts,
+		perTryTimeout: rc.PerTryTimeout,
+		statusCodes:   make(map[int]struct{}),
+		methods:       make(map[string]struct{}),
+		maxBodySize:   rc.MaxBodySize,
+	}
+	if rp.maxAttempts <= 0 {
+		rp.maxAttempts = config.DefaultRetryMaxAttempts
+	}
+	if rp.maxAttempts == 1 {
+		return nil
+	}
+	if rp.maxBodySize <= 0 {
+		rp.maxBodySize = config.DefaultRetryMaxBodySize
+	}
+	statusCodes := rc.StatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = defaultRetryStatusCodes
+	}
+	for _, code := range statusCodes {
+		rp.statusCodes[code] = struct{}{}
+	}
+	methods := rc.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, method := range methods {
+		rp.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	return rp
+}
+
+// attempts 请求的最大尝试次数，请求方法不可重试或请求体超过大小上限时为 1
+// 可以重试时将请求体读入内存并返回，没有请求体时返回 nil
+func (rp *retryPolicy) attempts(r *http.Request) (int, []byte) {
+	if rp == nil {
+		return 1, nil
+	}
+	if _, ok := rp.methods[r.Method]; !ok {
+		return 1, nil
+	}
+	body, ok := bufferBody(r, rp.maxBodySize)
+	if !ok {
+		return 1, nil
+	}
+	return rp.maxAttempts, body
+}
+
+// retryableStatus 响应状态码是否需要重试
+func (rp *retryPolicy) retryableStatus(status int) bool {
+	_, ok := rp.statusCodes[status]
+	return ok
+}
+
+// forward 使用 reverseProxy 将请求转发给服务器组 sg 中的服务器 s 并释放 s 的并发名额
+// body 不为 nil 时使用 body 作为请求体，timeout 为本次尝试的超时时间，为 0 时不限制
+// selectNext 不为 nil 时可以重试：连接失败、超时或响应状态码需要重试时先调用 selectNext 选择下一个服务器，
+// 选中时不写入响应，返回选中的服务器与失败原因；没有可选的服务器时写入本次尝试的响应（连接失败与超时为 502）
+func (p *proxy) forward(reverseProxy *httputil.ReverseProxy, rt *route, sg *ServerGroup, s *server.Server, w *statusRecorder, r *http.Request,
+	body []byte, timeout time.Duration, selectNext func() *server.Server) (*server.Server, error) {
+	req := r
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		req = r.WithContext(ctx)
+	}
+	if body != nil {
+		if req == r {
+			req = r.WithContext(r.Context())
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	reverseProxy.Director = func(req *http.Request) {
+		// 修改请求的目标地址为目标服务器
+		req.URL.Scheme = "http"
+		req.URL.Host = s.Addr()
+		// 按路由的改写规则改写路径与 Host
+		if rt.rewrite != nil {
+			rt.rewrite.apply(req, s.Addr())
+		}
+	}
+	var next *server.Server
+	var retryErr error
+	reverseProxy.ModifyResponse = nil
+	reverseProxy.ErrorHandler = nil
+	if selectNext != nil {
+		reverseProxy.ModifyResponse = func(resp *http.Response) error {
+			if p.retry.retryableStatus(resp.StatusCode) {
+				if next = selectNext(); next != nil {
+					return errors.New("response status code " + strconv.Itoa(resp.StatusCode))
+				}
+			}
+			return nil
+		}
+		reverseProxy.ErrorHandler = func(rw http.ResponseWriter, _ *http.Request, err error) {
+			retryErr = err
+			if next == nil {
+				next = selectNext()
+			}
+			if next == nil {
+				rw.WriteHeader(http.StatusBadGateway)
+			}
+		}
+	}
+
+	start := time.Now()
+	reverseProxy.ServeHTTP(w, req)
+
+	// 释放并发名额，记录响应延迟样本并调整并发限制；连接错误、超时与 5xx 响应计入断路器，客户端主动断开的请求不计入
+	failed := (retryErr != nil || w.status >= http.StatusInternalServerError) && r.Context().Err() != context.Canceled
+	s.ReleaseResult(time.Since(start), retryErr != nil || w.overloaded(), failed)
+	if sg.outlier != nil {
+		sg.outlier.onResult(s, failed)
+	}
+	return next, retryErr
+}
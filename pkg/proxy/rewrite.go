@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// rewriter 转发前改写请求路径与 Host
+type rewriter struct {
+	stripPrefix  string
+	regex        *regexp.Regexp
+	replacement  string
+	addPrefix    string
+	host         string
+	upstreamHost bool
+}
+
+// newRewriter 根据改写规则配置创建 rewriter，未配置任何改写时返回 nil
+func newRewriter(rc config.RewriteConfig) (*rewriter, error) {
+	if rc == (config.RewriteConfig{}) {
+		return nil, nil
+	}
+	rw := &rewriter{
+		stripPrefix:  rc.StripPrefix,
+		replacement:  rc.Replacement,
+		addPrefix:    rc.AddPrefix,
+		host:         rc.Host,
+		upstreamHost: rc.UpstreamHost,
+	}
+	if rc.Regex != "" {
+		regex, err := regexp.Compile(rc.Regex)
+		if err != nil {
+			return nil, err
+		}
+		rw.regex = regex
+	}
+	return rw, nil
+}
+
+// rewritePath 依次去除前缀（按路径段匹配，/api/v1 不会从 /api/v1users 中去除）、正则替换、添加前缀，改写后的路径总是以 / 开头
+func (rw *rewriter) rewritePath(path string) string {
+	if rw.stripPrefix != "" && hasPathPrefix(path, rw.stripPrefix) {
+		path = path[len(rw.stripPrefix):]
+	}
+	if rw.regex != nil {
+		path = rw.regex.ReplaceAllString(path, rw.replacement)
+	}
+	if rw.addPrefix != "" {
+		path = strings.TrimSuffix(rw.addPrefix, "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// apply 改写转发请求，upstream 为选中服务器的地址
+// 路径改写作用于转义后的路径（EscapedPath），%2F 等转义字符原样转发给服务器；改写结果不是有效的转义路径时按未转义的路径转发
+func (rw *rewriter) apply(req *http.Request, upstream string) {
+	if rw.stripPrefix != "" || rw.regex != nil || rw.addPrefix != "" {
+		escaped := rw.rewritePath(req.URL.EscapedPath())
+		if path, err := url.PathUnescape(escaped); err == nil {
+			req.URL.Path, req.URL.RawPath = path, escaped
+		} else {
+			req.URL.Path, req.URL.RawPath = escaped, ""
+		}
+	}
+	switch {
+	case rw.host != "":
+		req.Host = rw.host
+	case rw.upstreamHost:
+		req.Host = upstream
+	}
+}
@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/system/sysPrint"
+	"EH-Proxy/pkg/utils/datastructure"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// valueMatcher 请求头或查询参数匹配条件
+type valueMatcher struct {
+	name   string         // 请求头名称为规范格式（如 X-Tenant）
+	exact  string         // 完全匹配的值
+	prefix string         // 匹配的前缀
+	regex  *regexp.Regexp // 匹配的正则表达式
+}
+
+// newValueMatcher 根据匹配条件配置创建 valueMatcher，header 为 true 时名称转换为规范的请求头格式
+func newValueMatcher(mc config.MatchConfig, header bool) (*valueMatcher, error) {
+	set := 0
+	for _, v := range []string{mc.Exact, mc.Prefix, mc.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, sysPrint.ErrMatchConditionInvalid
+	}
+	m := &valueMatcher{name: mc.Name, exact: mc.Exact, prefix: mc.Prefix}
+	if header {
+		m.name = http.CanonicalHeaderKey(mc.Name)
+	}
+	if mc.Regex != "" {
+		regex, err := regexp.Compile(mc.Regex)
+		if err != nil {
+			return nil, err
+		}
+		m.regex = regex
+	}
+	return m, nil
+}
+
+// match 任意一个值满足条件即匹配，values 为空表示不存在该请求头或查询参数
+func (m *valueMatcher) match(values []string) bool {
+	for _, v := range values {
+		switch {
+		case m.exact != "":
+			if v == m.exact {
+				return true
+			}
+		case m.prefix != "":
+			if strings.HasPrefix(v, m.prefix) {
+				return true
+			}
+		case m.regex != nil:
+			if m.regex.MatchString(v) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// route 路由规则
+type route struct {
+	host       string                   // 小写的 Host，通配符规则为去掉 * 后的后缀（如 .example.com），为空时匹配任意 Host
+	wildcard   bool                     // 是否为通配符规则
+	pathPrefix string                   // 路径前缀
+	path       *datastructure.RadixTree // 路径模式，为 nil 时匹配任意路径
+	pathLen    int                      // 路径前缀与路径模式的长度之和，用于路由排序
+	methods    []string                 // 大写的请求方法，为空时匹配任意方法
+	headers    []*valueMatcher          // 请求头匹配条件
+	query      []*valueMatcher          // 查询参数匹配条件
+	name       string                   // 路由名称
+	group      *ServerGroup             // 转发的服务器组，split 不为 nil 时为 nil
+	split      *trafficSplit            // 按权重在多个服务器组之间分流
+	mirror     *mirror                  // 请求镜像，为 nil 时不镜像
+	rewrite    *rewriter                // 请求改写规则，为 nil 时不改写
+}
+
+// matchPath 请求路径是否满足路由的路径前缀与路径模式
+func (rt *route) matchPath(path string) bool {
+	if !hasPathPrefix(path, rt.pathPrefix) {
+		return false
+	}
+	if rt.path != nil {
+		_, ok := rt.path.Match(path)
+		return ok
+	}
+	return true
+}
+
+// hasPathPrefix 路径是否以 prefix 为前缀，按路径段比较：/api 匹配 /api 与 /api/users，但不匹配 /apiary
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// conditions 请求方法、请求头与查询参数条件的数量，数量较多的路由更具体，优先匹配
+func (rt *route) conditions() int {
+	n := len(rt.headers) + len(rt.query)
+	if len(rt.methods) > 0 {
+		n++
+	}
+	return n
+}
+
+// matchConditions 请求是否满足路由的请求方法、请求头与查询参数条件，query 为 nil 时按需解析
+func (rt *route) matchConditions(r *http.Request, query *url.Values) bool {
+	if len(rt.methods) > 0 {
+		ok := false
+		for _, method := range rt.methods {
+			if r.Method == method {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, m := range rt.headers {
+		if !m.match(r.Header[m.name]) {
+			return false
+		}
+	}
+	if len(rt.query) > 0 && *query == nil {
+		*query = r.URL.Query()
+	}
+	for _, m := range rt.query {
+		if !m.match((*query)[m.name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostRank Host 匹配的优先级，完全匹配 > 通配符匹配 > 不限 Host
+func (rt *route) hostRank() int {
+	switch {
+	case rt.host == "":
+		return 0
+	case rt.wildcard:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matchHost host 需为小写且不含端口
+func (rt *route) matchHost(host string) bool {
+	switch {
+	case rt.host == "":
+		return true
+	case rt.wildcard:
+		return strings.HasSuffix(host, rt.host) && len(host) > len(rt.host)
+	default:
+		return host == rt.host
+	}
+}
+
+// serverGroup 选择处理请求的服务器组
+func (rt *route) serverGroup(r *http.Request) *ServerGroup {
+	if rt.split != nil {
+		return rt.split.selectGroup(r)
+	}
+	return rt.group
+}
+
+// router 根据请求的 Host 与路径前缀选择服务器组
+type router struct {
+	routes []*route // 按优先级从高到低排序
+}
+
+// newRouter 根据路由配置创建路由表，路由引用的服务器组不存在、路由名称重复或匹配条件无效时返回错误
+// hashKey 为未设置分流键来源时使用的分流键来源
+func newRouter(routeConfigs []config.RouteConfig, groups map[string]*ServerGroup, hashKey string) (*router, error) {
+	routes := make([]*route, 0, len(routeConfigs))
+	names := make(map[string]struct{})
+	for _, rc := range routeConfigs {
+		if rc.Name != "" {
+			if _, ok := names[rc.Name]; ok {
+				return nil, sysPrint.ErrRouteExists
+			}
+			names[rc.Name] = struct{}{}
+		}
+		rt := &route{
+			name:       rc.Name,
+			host:       strings.ToLower(rc.Host),
+			pathPrefix: rc.PathPrefix,
+		}
+		if rc.Split != nil {
+			split, err := newTrafficSplit(rc.Split, groups, hashKey)
+			if err != nil {
+				return nil, err
+			}
+			rt.split = split
+		} else {
+			group, ok := groups[rc.Group]
+			if !ok {
+				return nil, sysPrint.ErrGroupNotExists
+			}
+			rt.group = group
+		}
+		if strings.HasPrefix(rt.host, "*.") {
+			rt.host = rt.host[1:]
+			rt.wildcard = true
+		}
+		for _, method := range rc.Methods {
+			rt.methods = append(rt.methods, strings.ToUpper(method))
+		}
+		for _, mc := range rc.Headers {
+			m, err := newValueMatcher(mc, true)
+			if err != nil {
+				return nil, err
+			}
+			rt.headers = append(rt.headers, m)
+		}
+		for _, mc := range rc.Query {
+			m, err := newValueMatcher(mc, false)
+			if err != nil {
+				return nil, err
+			}
+			rt.query = append(rt.query, m)
+		}
+		rt.pathLen = len(rc.PathPrefix) + len(rc.Path)
+		if rc.Path != "" {
+			rt.path = datastructure.NewRadixTree()
+			for _, pattern := range config.UrlPathPatterns(rc.Path) {
+				err := rt.path.Insert(pattern, nil)
+				if err != nil && err != sysPrint.ErrPathPatternExists {
+					return nil, err
+				}
+			}
+		}
+		if rc.Mirror != nil {
+			m, err := newMirror(rc.Mirror, groups)
+			if err != nil {
+				return nil, err
+			}
+			rt.mirror = m
+		}
+		rw, err := newRewriter(rc.Rewrite)
+		if err != nil {
+			return nil, err
+		}
+		rt.rewrite = rw
+		routes = append(routes, rt)
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if ri, rj := routes[i].hostRank(), routes[j].hostRank(); ri != rj {
+			return ri > rj
+		}
+		if len(routes[i].host) != len(routes[j].host) {
+			return len(routes[i].host) > len(routes[j].host)
+		}
+		if ci, cj := routes[i].conditions(), routes[j].conditions(); ci != cj {
+			return ci > cj
+		}
+		return routes[i].pathLen > routes[j].pathLen
+	})
+	return &router{routes: routes}, nil
+}
+
+// requestHost 获取请求的 Host（小写，不含端口）
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// find 根据名称查找路由，不存在时返回 nil
+func (rtr *router) find(name string) *route {
+	for _, rt := range rtr.routes {
+		if rt.name == name {
+			return rt
+		}
+	}
+	return nil
+}
+
+// match 返回第一个匹配请求的路由，没有匹配的路由时返回 nil
+func (rtr *router) match(r *http.Request) *route {
+	if len(rtr.routes) == 0 {
+		return nil
+	}
+	host := requestHost(r)
+	var query url.Values
+	for _, rt := range rtr.routes {
+		if rt.matchHost(host) && rt.matchPath(r.URL.Path) && rt.matchConditions(r, &query) {
+			return rt
+		}
+	}
+	return nil
+}
@@ -6,23 +6,33 @@ import (
 	"EH-Proxy/pkg/slb"
 	"EH-Proxy/pkg/system/sysPrint"
 	"log"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 )
 
-func NewServerGroup(balancerType slb.LoadBalancerType) *ServerGroup {
-	lb, err := slb.LoadBalancerFactory(balancerType)
+func NewServerGroup(name string, balancerType slb.LoadBalancerType, balancerOptions map[slb.LoadBalancerType]map[string]any) *ServerGroup {
+	lb, err := slb.TieredLoadBalancerFactory(balancerType, balancerOptions[balancerType])
 	if err != nil {
 		log.Fatalln(err)
 	}
 	return &ServerGroup{
-		serverMap:    make(map[string]*server.Server),
-		mapRWLock:    sync.RWMutex{},
-		loadBalancer: lb,
-		pfailCount:   0,
+		name:             name,
+		serverMap:        make(map[string]*server.Server),
+		mapRWLock:        sync.RWMutex{},
+		loadBalancer:     lb,
+		loadBalancerType: balancerType,
+		lbOptions:        balancerOptions,
+		lbRWLock:         sync.RWMutex{},
+		pfailCount:       0,
+		stickyMap:        make(map[string]string),
 	}
 }
 
+func (s *ServerGroup) Name() string {
+	return s.name
+}
+
 func (s *ServerGroup) ServerMap() map[string]*server.Server {
 	s.mapRWLock.RLock()
 	defer s.mapRWLock.RUnlock()
@@ -36,21 +46,52 @@ func (s *ServerGroup) SetServerMap(serverMap map[string]*server.Server) {
 }
 
 func (s *ServerGroup) AddServer(p *proxy, addr string, weight int32, probe string) error {
+	return s.AddServerWithConfig(p, config.ServerConfig{Addr: addr, Weight: weight, Probe: probe})
+}
+
+// AddServerWithConfig 根据服务器配置添加服务器，若配置了慢启动则新服务器从较小的有效权重开始接收请求
+func (s *ServerGroup) AddServerWithConfig(p *proxy, sc config.ServerConfig) error {
+	return s.addServer(p, sc, true)
+}
+
+// addServer 添加服务器，warmUp 为 false 时不进行慢启动（如 proxy 启动时加载配置文件中的服务器列表）
+func (s *ServerGroup) addServer(p *proxy, sc config.ServerConfig, warmUp bool) error {
 	s.mapRWLock.Lock()
 	defer s.mapRWLock.Unlock()
-	if _, ok := s.serverMap[addr]; ok {
+	if _, ok := s.serverMap[sc.Addr]; ok {
 		return sysPrint.ErrServerExists
 	}
-	newServer, err := server.NewServer(addr, weight, probe)
+	newServer, err := server.NewServer(sc.Addr, sc.Weight, sc.Probe)
 	if err != nil {
 		return err
 	}
-	s.serverMap[addr] = newServer
+	if sc.SlowStart > 0 {
+		newServer.SetSlowStart(sc.SlowStart)
+	} else {
+		newServer.SetSlowStart(p.config.SlowStart)
+	}
+	if warmUp {
+		newServer.StartSlowStart()
+	}
+	if sc.Backup {
+		newServer.SetPriority(server.BackupPriority)
+	} else {
+		newServer.SetPriority(sc.Priority)
+	}
+	if p.config.ConcurrencyLimit.Enable {
+		newServer.SetLimiter(server.NewLimiter(p.config.ConcurrencyLimit.LimiterOptions()))
+	}
+	if p.config.CircuitBreakerOption {
+		newServer.SetBreaker(server.NewBreaker(p.config.CircuitBreaker.BreakerOptions()))
+	}
+	newServer.SetObserver(s)
+	s.serverMap[sc.Addr] = newServer
+	s.stickyMap[stickyToken(p.config.StickySession.Secret, sc.Addr)] = sc.Addr
 	err = s.loadBalancer.AddServerNode(newServer)
 	if err != nil {
 		return err
 	}
-	go p.healthCheck(newServer)
+	go p.healthCheck(s, newServer)
 	return nil
 }
 
@@ -67,9 +108,83 @@ func (s *ServerGroup) DeleteServer(addr string) error {
 	}
 	sv.CloseStopHealthCheck()
 	delete(s.serverMap, addr)
+	for token, a := range s.stickyMap {
+		if a == addr {
+			delete(s.stickyMap, token)
+			break
+		}
+	}
+	return nil
+}
+
+// StickyServer 根据会话保持 cookie 值获取服务器，服务器已被删除、被主观认为下线或被驱逐时返回 nil
+// 存在优先级更高的可用服务器时也返回 nil（如主服务器恢复后 cookie 仍记录着备用服务器），由负载均衡器重新选择
+func (s *ServerGroup) StickyServer(token string) *server.Server {
+	s.mapRWLock.RLock()
+	defer s.mapRWLock.RUnlock()
+	addr, ok := s.stickyMap[token]
+	if !ok {
+		return nil
+	}
+	sv, ok := s.serverMap[addr]
+	if !ok || sv.Pfail() == server.IS_PFAIL || sv.Ejected() {
+		return nil
+	}
+	if best, ok := s.bestPriority(); ok && sv.Priority() > best {
+		return nil
+	}
+	return sv
+}
+
+// TryAcquireAny 在优先级最高的可用服务器层中，按有效权重随机选择一个 exclude 以外的服务器并占用其一个并发名额
+// 该层服务器都达到并发限制或都在 exclude 中时返回 nil，不会转而选择优先级更低的服务器（如备用服务器）
+func (s *ServerGroup) TryAcquireAny(exclude ...*server.Server) *server.Server {
+	s.mapRWLock.RLock()
+	defer s.mapRWLock.RUnlock()
+	best, ok := s.bestPriority()
+	if !ok {
+		return nil
+	}
+	// 慢启动中的有效权重会随时间变化，先记录下来保证随机选择时总权重不变
+	candidates := make([]*server.Server, 0)
+	weights := make([]int64, 0)
+	var total int64
+	for _, sv := range s.serverMap {
+		if sv.Available() && sv.Priority() == best && !containsServer(exclude, sv) {
+			candidates = append(candidates, sv)
+			weights = append(weights, int64(sv.EffectiveWeight()))
+			total += weights[len(weights)-1]
+		}
+	}
+	for len(candidates) > 0 {
+		// 按有效权重随机选择一个候选服务器，占用失败时将其移出候选列表
+		n := rand.Int63n(total)
+		i := 0
+		for ; n >= weights[i]; i++ {
+			n -= weights[i]
+		}
+		sv := candidates[i]
+		if sv.TryAcquire() {
+			return sv
+		}
+		last := len(candidates) - 1
+		total -= weights[i]
+		candidates[i], weights[i] = candidates[last], weights[last]
+		candidates, weights = candidates[:last], weights[:last]
+	}
 	return nil
 }
 
+// bestPriority 获取可用服务器中最高的优先级（数值最小），没有可用服务器时 ok 为 false。调用方需持有 mapRWLock
+func (s *ServerGroup) bestPriority() (best int32, ok bool) {
+	for _, sv := range s.serverMap {
+		if sv.Available() && (!ok || sv.Priority() < best) {
+			best, ok = sv.Priority(), true
+		}
+	}
+	return best, ok
+}
+
 func (s *ServerGroup) SetWeight(addr string, weight int32) error {
 	s.mapRWLock.Lock()
 	defer s.mapRWLock.Unlock()
@@ -84,6 +199,23 @@ func (s *ServerGroup) SetWeight(addr string, weight int32) error {
 	return nil
 }
 
+// OnServerUpdate 服务器状态变更时通知当前的负载均衡器
+func (s *ServerGroup) OnServerUpdate(sv *server.Server, change server.ChangeType) {
+	s.LoadBalancer().OnServerUpdate(sv, change)
+}
+
+// SetDrain 设置服务器的排空状态，排空中的服务器不再被负载均衡器选择
+func (s *ServerGroup) SetDrain(addr string, drain bool) error {
+	s.mapRWLock.RLock()
+	defer s.mapRWLock.RUnlock()
+	sv, ok := s.serverMap[addr]
+	if !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	sv.SetDrain(drain)
+	return nil
+}
+
 func (s *ServerGroup) IsServerExists(addr string) bool {
 	s.mapRWLock.Lock()
 	defer s.mapRWLock.Unlock()
@@ -105,11 +237,44 @@ func (s *ServerGroup) GetServer(addr string) (*server.Server, error) {
 }
 
 func (s *ServerGroup) LoadBalancer() slb.LoadBalancer {
+	s.lbRWLock.RLock()
+	defer s.lbRWLock.RUnlock()
 	return s.loadBalancer
 }
 
-func (s *ServerGroup) SetLoadBalancer(loadBalancer slb.LoadBalancer) {
+func (s *ServerGroup) LoadBalancerType() slb.LoadBalancerType {
+	s.lbRWLock.RLock()
+	defer s.lbRWLock.RUnlock()
+	return s.loadBalancerType
+}
+
+func (s *ServerGroup) SetLoadBalancer(balancerType slb.LoadBalancerType, loadBalancer slb.LoadBalancer) {
+	s.lbRWLock.Lock()
+	defer s.lbRWLock.Unlock()
 	s.loadBalancer = loadBalancer
+	s.loadBalancerType = balancerType
+}
+
+// SwitchLoadBalancer 运行时切换负载均衡算法
+// 创建 balancerType 类型的负载均衡器并使用当前所有服务器初始化，完成后原子地替换原负载均衡器，
+// 切换期间持有哈希表写锁，阻止服务器的添加与删除，正在转发的请求不受影响
+func (s *ServerGroup) SwitchLoadBalancer(balancerType slb.LoadBalancerType) error {
+	lb, err := slb.TieredLoadBalancerFactory(balancerType, s.lbOptions[balancerType])
+	if err != nil {
+		return err
+	}
+	s.mapRWLock.Lock()
+	defer s.mapRWLock.Unlock()
+	serverList := make([]*server.Server, 0, len(s.serverMap))
+	for _, sv := range s.serverMap {
+		serverList = append(serverList, sv)
+	}
+	err = lb.InitServerNode(serverList)
+	if err != nil {
+		return err
+	}
+	s.SetLoadBalancer(balancerType, lb)
+	return nil
 }
 
 func (s *ServerGroup) PfailCount() int32 {
@@ -124,24 +289,36 @@ func (s *ServerGroup) addPfailCount(delta int32) {
 	atomic.AddInt32(&s.pfailCount, delta)
 }
 
-func (s *ServerGroup) saveServerListToDisk() error {
-	s.mapRWLock.Lock()
-	s.mapRWLock.Unlock()
-	p := GetProxyInstance()
-	newServerList := make([]config.ServerConfig, 0)
-	for _, s := range p.serverGroup.ServerMap() {
+// serverConfigList 获取服务器组当前的服务器配置列表，用于保存到本地配置文件
+func (s *ServerGroup) serverConfigList(p *proxy) []config.ServerConfig {
+	s.mapRWLock.RLock()
+	defer s.mapRWLock.RUnlock()
+	newServerList := make([]config.ServerConfig, 0, len(s.serverMap))
+	for _, sv := range s.serverMap {
 		srv := config.ServerConfig{
-			Addr:   s.Addr(),
-			Weight: s.Weight(),
-			Probe:  s.Probe(),
+			Addr:   sv.Addr(),
+			Weight: sv.Weight(),
+			Probe:  sv.Probe(),
+		}
+		if sv.SlowStart() != p.config.SlowStart {
+			srv.SlowStart = sv.SlowStart()
+		}
+		if sv.IsBackup() {
+			srv.Backup = true
+		} else {
+			srv.Priority = sv.Priority()
 		}
 		newServerList = append(newServerList, srv)
 	}
-	p.config.InitServerList = newServerList
-	err := config.WriteConfig(p.config)
-	if err != nil {
-		return err
+	return newServerList
+}
+
+// containsServer servers 中是否包含服务器 s
+func containsServer(servers []*server.Server, s *server.Server) bool {
+	for _, sv := range servers {
+		if sv == s {
+			return true
+		}
 	}
-	sysPrint.PrintlnSystemMsg("Save current config to disk success.")
-	return nil
+	return false
 }
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/system/sysPrint"
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+)
+
+// splitTarget 分流的服务器组与权重
+type splitTarget struct {
+	group  *ServerGroup
+	weight uint32
+}
+
+// splitTable 分流表，调整权重时整体替换，请求处理过程中不会看到更新了一半的分流表
+type splitTable struct {
+	targets []splitTarget
+	total   uint32
+}
+
+// newSplitTable 根据分流配置创建分流表，服务器组不存在或权重无效时返回错误
+func newSplitTable(groupConfigs []config.SplitGroupConfig, groups map[string]*ServerGroup) (*splitTable, error) {
+	table := &splitTable{targets: make([]splitTarget, 0, len(groupConfigs))}
+	for _, gc := range groupConfigs {
+		group, ok := groups[gc.Group]
+		if !ok {
+			return nil, sysPrint.ErrGroupNotExists
+		}
+		if gc.Weight < 0 {
+			return nil, sysPrint.ErrSplitWeightInvalid
+		}
+		table.targets = append(table.targets, splitTarget{group: group, weight: uint32(gc.Weight)})
+		table.total += uint32(gc.Weight)
+	}
+	if table.total == 0 {
+		return nil, sysPrint.ErrSplitWeightInvalid
+	}
+	return table, nil
+}
+
+// trafficSplit 按权重在多个服务器组之间分流
+type trafficSplit struct {
+	table    atomic.Value // *splitTable
+	key      string       // 分流键来源
+	override string       // 强制指定服务器组的请求头或 cookie
+}
+
+// newTrafficSplit 创建分流器，sc.Key 为空时使用 hashKey 作为分流键来源
+func newTrafficSplit(sc *config.SplitConfig, groups map[string]*ServerGroup, hashKey string) (*trafficSplit, error) {
+	ts := &trafficSplit{key: sc.Key, override: sc.Override}
+	if ts.key == "" {
+		ts.key = hashKey
+	}
+	err := ts.update(sc.Groups, groups)
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// update 替换分流表
+func (ts *trafficSplit) update(groupConfigs []config.SplitGroupConfig, groups map[string]*ServerGroup) error {
+	table, err := newSplitTable(groupConfigs, groups)
+	if err != nil {
+		return err
+	}
+	ts.table.Store(table)
+	return nil
+}
+
+// splitBucket 计算分流键所在的区间 [0, total)
+func splitBucket(key string, total uint32) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() % total
+}
+
+// selectGroup 选择处理请求的服务器组
+// 请求通过 override 指定了分流表中的服务器组时直接使用该服务器组，否则根据分流键的哈希值按权重选择
+func (ts *trafficSplit) selectGroup(r *http.Request) *ServerGroup {
+	table := ts.table.Load().(*splitTable)
+	if ts.override != "" {
+		if name := requestValue(r, ts.override); name != "" {
+			for _, t := range table.targets {
+				if t.group.Name() == name {
+					return t.group
+				}
+			}
+		}
+	}
+	bucket := splitBucket(requestHashKey(r, ts.key), table.total)
+	for _, t := range table.targets {
+		if bucket < t.weight {
+			return t.group
+		}
+		bucket -= t.weight
+	}
+	return table.targets[len(table.targets)-1].group
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"EH-Proxy/pkg/server"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	stickyTokenLength = 32 // cookie 值长度（十六进制字符数）
+)
+
+// stickyToken 计算服务器对应的会话保持 cookie 值：HMAC-SHA256(secret, addr) 的十六进制前缀，不暴露服务器地址
+func stickyToken(secret, addr string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(addr))
+	return hex.EncodeToString(mac.Sum(nil))[:stickyTokenLength]
+}
+
+// stickyCookieName 服务器组使用的会话保持 cookie 名称，默认服务器组使用配置的名称，其他服务器组在其后加上 _组名
+func (p *proxy) stickyCookieName(sg *ServerGroup) string {
+	if sg == p.serverGroup {
+		return p.config.StickySession.CookieName
+	}
+	return p.config.StickySession.CookieName + "_" + sg.Name()
+}
+
+// stickyServer 根据请求携带的会话保持 cookie 取出服务器组 sg 中之前分配的服务器
+// 未携带 cookie、服务器已被删除、被主观认为下线或存在优先级更高的可用服务器时返回 nil
+func (p *proxy) stickyServer(sg *ServerGroup, r *http.Request) *server.Server {
+	c, err := r.Cookie(p.stickyCookieName(sg))
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	return sg.StickyServer(c.Value)
+}
+
+// setStickyCookie 在响应中设置会话保持 cookie，记录本次分配的服务器
+func (p *proxy) setStickyCookie(sg *ServerGroup, w http.ResponseWriter, s *server.Server) {
+	sc := p.config.StickySession
+	cookie := &http.Cookie{
+		Name:     p.stickyCookieName(sg),
+		Value:    stickyToken(sc.Secret, s.Addr()),
+		Path:     "/",
+		Secure:   sc.Secure,
+		HttpOnly: true,
+	}
+	if sc.TTL > 0 {
+		cookie.MaxAge = int(sc.TTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
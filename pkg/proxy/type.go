@@ -5,13 +5,23 @@ import (
 	"EH-Proxy/pkg/server"
 	"EH-Proxy/pkg/slb"
 	"EH-Proxy/pkg/system/sysPrint"
+	"net/http"
 	"sync"
+	"sync/atomic"
 )
 
 type proxy struct {
-	serverGroup *ServerGroup
-	config      *config.ProxyConfig
-	stop        chan struct{}
+	serverGroup     *ServerGroup            // 默认服务器组
+	serverGroups    map[string]*ServerGroup // 所有服务器组（包含默认服务器组），key: 组名
+	router          *router                 // 路由表
+	defaultRoute    *route                  // 未匹配任何路由的请求使用的路由，转发给默认服务器组
+	mirrorSem       chan struct{}           // 限制同时进行的镜像请求数
+	mirrorTransport http.RoundTripper       // 发送镜像请求使用的 Transport
+	urlPaths        atomic.Value            // *urlPathTable，URL 路径检测使用的路径表
+	urlPathsMu      sync.Mutex              // 修改 URL 路径表的互斥锁
+	retry           *retryPolicy            // 请求重试策略，为 nil 时不重试
+	config          *config.ProxyConfig
+	stop            chan struct{}
 }
 
 var once sync.Once
@@ -24,29 +34,106 @@ func GetProxyInstance() *proxy {
 		if err != nil {
 			sysPrint.PrintlnAndLogWriteFatalMsg(err.Error())
 		}
+		if c.StickySession.CookieName == "" {
+			c.StickySession.CookieName = config.DefaultStickyCookieName
+		}
+		if c.StickySession.Secret == "" {
+			c.StickySession.Secret = config.RandomSecret()
+			sysPrint.PrintlnSystemMsg("sticky-session secret is not set, using a random one, cookies will be invalid after restart.")
+		}
+		if c.ConcurrencyLimit.RetryAfter <= 0 {
+			c.ConcurrencyLimit.RetryAfter = config.DefaultRetryAfter
+		}
+		if c.Mirror.MaxConcurrency <= 0 {
+			c.Mirror.MaxConcurrency = config.DefaultMirrorConcurrency
+		}
+		if c.Mirror.MaxBodySize <= 0 {
+			c.Mirror.MaxBodySize = config.DefaultMirrorMaxBodySize
+		}
+		if c.Mirror.Timeout <= 0 {
+			c.Mirror.Timeout = config.DefaultMirrorTimeout
+		}
 		proxyInstance = &proxy{
+			serverGroups: make(map[string]*ServerGroup),
+			mirrorSem:    make(chan struct{}, c.Mirror.MaxConcurrency),
+			mirrorTransport: &http.Transport{
+				DisableKeepAlives: !c.KeepAliveOption,
+				Proxy:             http.ProxyFromEnvironment,
+			},
+			retry:  newRetryPolicy(c.Retry),
 			config: c,
 			stop:   make(chan struct{}, 1),
 		}
-		sg := NewServerGroup(c.LoadBalancerType)
-		for _, s := range c.InitServerList {
-			err = sg.AddServer(proxyInstance, s.Addr, s.Weight, s.Probe)
-			if err != nil {
-				sysPrint.PrintlnAndLogWriteFatalMsg(err.Error())
+		proxyInstance.initUrlPaths()
+		proxyInstance.serverGroup = proxyInstance.initServerGroup(config.DefaultGroupName, c.LoadBalancerType, c.InitServerList)
+		proxyInstance.defaultRoute = &route{group: proxyInstance.serverGroup}
+		for _, gc := range c.ServerGroups {
+			if _, ok := proxyInstance.serverGroups[gc.Name]; ok || gc.Name == "" {
+				sysPrint.PrintlnAndLogWriteFatalMsg("invalid server group name: \"" + gc.Name + "\", " + sysPrint.ErrGroupExists.Error())
+				continue
+			}
+			balancerType := gc.LoadBalancerType
+			if balancerType == "" {
+				balancerType = c.LoadBalancerType
 			}
+			proxyInstance.initServerGroup(gc.Name, balancerType, gc.ServerList)
+		}
+		proxyInstance.router, err = newRouter(c.Routes, proxyInstance.serverGroups, c.HashKey)
+		if err != nil {
+			sysPrint.PrintlnAndLogWriteFatalMsg("invalid routes: " + err.Error())
+			proxyInstance.router = &router{}
 		}
-		proxyInstance.serverGroup = sg
 	})
 	return proxyInstance
 }
 
+// initServerGroup 创建服务器组并加载服务器列表
+func (p *proxy) initServerGroup(name string, balancerType slb.LoadBalancerType, serverList []config.ServerConfig) *ServerGroup {
+	sg := NewServerGroup(name, balancerType, p.config.LoadBalancerOptions)
+	p.serverGroups[name] = sg
+	if p.config.OutlierDetection.Enable {
+		sg.outlier = newOutlierDetector(sg, p.config.OutlierDetection)
+		go sg.outlier.run()
+	}
+	for _, s := range serverList {
+		err := sg.addServer(p, s, false)
+		if err != nil {
+			sysPrint.PrintlnAndLogWriteFatalMsg(err.Error())
+		}
+	}
+	return sg
+}
+
+// ServerGroup 根据组名获取服务器组
+func (p *proxy) ServerGroup(name string) (*ServerGroup, error) {
+	sg, ok := p.serverGroups[name]
+	if !ok {
+		return nil, sysPrint.ErrGroupNotExists
+	}
+	return sg, nil
+}
+
+// route 根据路由表选择处理请求的路由，未匹配任何路由时使用转发给默认服务器组且不改写请求的默认路由
+func (p *proxy) route(r *http.Request) *route {
+	if rt := p.router.match(r); rt != nil {
+		return rt
+	}
+	return p.defaultRoute
+}
+
 func (p *proxy) HealthCheckOption() bool {
 	return p.config.HealthCheckOption
 }
 
 type ServerGroup struct {
-	serverMap    map[string]*server.Server // 服务器哈希表，key: address
-	mapRWLock    sync.RWMutex              // 哈希表读写锁
-	loadBalancer slb.LoadBalancer          // 负载均衡器
-	pfailCount   int32                     // 主观下线的服务器数目
+	name             string                                  // 服务器组名称
+	serverMap        map[string]*server.Server               // 服务器哈希表，key: address
+	mapRWLock        sync.RWMutex                            // 哈希表读写锁
+	loadBalancer     slb.LoadBalancer                        // 负载均衡器
+	loadBalancerType slb.LoadBalancerType                    // 负载均衡器类型
+	lbOptions        map[slb.LoadBalancerType]map[string]any // 各类型负载均衡器的选项
+	lbRWLock         sync.RWMutex                            // 负载均衡器读写锁
+	pfailCount       int32                                   // 主观下线的服务器数目
+	stickyMap        map[string]string                       // 会话保持 cookie 值-服务器地址 哈希表
+	outlier          *outlierDetector                        // 被动异常检测器，为 nil 时不进行异常检测
 }
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"EH-Proxy/config"
+	"EH-Proxy/pkg/system/sysPrint"
+	"EH-Proxy/pkg/utils/datastructure"
+	"net/http"
+	"sort"
+)
+
+// pathResponse URL 路径检测拒绝请求时的响应
+type pathResponse struct {
+	status   int
+	body     []byte
+	location string // 重定向地址，为空时不重定向
+}
+
+// newPathResponse 根据响应配置创建 pathResponse，未设置状态码时使用 defaultStatus，设置了重定向地址时为 302
+func newPathResponse(rc config.UrlPathResponseConfig, defaultStatus int) (*pathResponse, error) {
+	resp := &pathResponse{status: rc.Status, body: []byte(rc.Body), location: rc.Location}
+	if resp.status == 0 {
+		resp.status = defaultStatus
+		if resp.location != "" {
+			resp.status = http.StatusFound
+		}
+	}
+	if resp.status < 200 || resp.status > 599 || (resp.location != "" && resp.status/100 != 3) {
+		return nil, sysPrint.ErrUrlPathResponseInvalid
+	}
+	if len(resp.body) == 0 {
+		resp.body = []byte(http.StatusText(resp.status))
+	}
+	return resp, nil
+}
+
+// write 写入响应
+func (resp *pathResponse) write(w http.ResponseWriter) {
+	if resp.location != "" {
+		w.Header().Set("Location", resp.location)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(resp.status)
+	_, err := w.Write(resp.body)
+	if err != nil {
+		sysPrint.PrintlnErrorMsg(err.Error())
+	}
+}
+
+// urlPathTable URL 路径检测使用的路径集合与匹配树
+// 更新时复制一份修改后整体替换（copy-on-write），正在处理的请求总是看到完整的新表或旧表
+type urlPathTable struct {
+	deny     bool                                     // 是否为拒绝名单模式
+	response *pathResponse                            // 默认的拒绝响应
+	paths    map[string]*config.UrlPathResponseConfig // url-path-map 中的路径与响应配置
+	tree     *datastructure.RadixTree                 // 路径编译后的匹配树，value 为路径的拒绝响应（*pathResponse），为 nil 时使用默认响应
+}
+
+// pathResponseOf 创建路径的拒绝响应，未设置响应时返回 nil，响应无效时返回错误
+func (t *urlPathTable) pathResponseOf(rc *config.UrlPathResponseConfig) (*pathResponse, error) {
+	if rc == nil || *rc == (config.UrlPathResponseConfig{}) {
+		return nil, nil
+	}
+	return newPathResponse(*rc, t.response.status)
+}
+
+// patternRank 路径 path 转换出的模式 pattern 的优先级，数值越小优先级越高
+// 多个路径转换出相同的模式时（如 /api 与 /api* 都转换出 /api），由优先级最高的路径决定该模式的拒绝响应：
+// 与模式完全相同的路径优先，其次是 /x/* 形式的路径，最后是 /x* 形式的路径
+func patternRank(path, pattern string) int {
+	if path == pattern {
+		return 0
+	}
+	if len(config.UrlPathPatterns(path)) == 1 {
+		return 1
+	}
+	return 2
+}
+
+// rebuild 根据 paths 重新构建匹配树，每个模式的拒绝响应由 patternRank 最高的路径决定，与路径的添加顺序无关
+// 无效的路径与响应通过 report 报告（report 为 nil 时不报告）：路径无效时不插入其模式，响应无效时使用默认响应
+func (t *urlPathTable) rebuild(report func(path string, err error)) {
+	if report == nil {
+		report = func(string, error) {}
+	}
+	paths := make([]string, 0, len(t.paths))
+	for path := range t.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	owners := make(map[string]string)
+	patterns := make([]string, 0, len(paths))
+	responses := make(map[string]*pathResponse, len(paths))
+	for _, path := range paths {
+		resp, err := t.pathResponseOf(t.paths[path])
+		if err != nil {
+			report(path, err)
+		}
+		responses[path] = resp
+		for _, pattern := range config.UrlPathPatterns(path) {
+			owner, ok := owners[pattern]
+			if !ok {
+				patterns = append(patterns, pattern)
+			}
+			if !ok || patternRank(path, pattern) < patternRank(owner, pattern) {
+				owners[pattern] = path
+			}
+		}
+	}
+
+	t.tree = datastructure.NewRadixTree()
+	invalid := make(map[string]error)
+	for _, pattern := range patterns {
+		err := t.tree.Insert(pattern, responses[owners[pattern]])
+		if err != nil {
+			invalid[pattern] = err
+		}
+	}
+	for _, path := range paths {
+		for _, pattern := range config.UrlPathPatterns(path) {
+			if err, ok := invalid[pattern]; ok {
+				report(path, err)
+				break
+			}
+		}
+	}
+}
+
+// clone 复制路径表，用于 copy-on-write 更新，修改路径后需调用 rebuild 重新构建匹配树
+func (t *urlPathTable) clone() *urlPathTable {
+	paths := make(map[string]*config.UrlPathResponseConfig, len(t.paths)+1)
+	for k, v := range t.paths {
+		paths[k] = v
+	}
+	return &urlPathTable{deny: t.deny, response: t.response, paths: paths, tree: t.tree}
+}
+
+// initUrlPaths 根据配置文件的 url-path-check-mode、url-path-check-response 与 url-path-map 初始化 URL 路径表
+// 无效的配置会输出错误信息并被忽略
+func (p *proxy) initUrlPaths() {
+	table := &urlPathTable{
+		response: &pathResponse{status: http.StatusBadRequest, body: invalidURLPath},
+		paths:    make(map[string]*config.UrlPathResponseConfig, len(p.config.UrlPathMap)),
+		tree:     datastructure.NewRadixTree(),
+	}
+	switch p.config.UrlPathCheckMode {
+	case "", config.UrlPathCheckAllow:
+	case config.UrlPathCheckDeny:
+		table.deny = true
+	default:
+		sysPrint.PrintlnAndLogWriteFatalMsg(sysPrint.ErrUrlPathCheckModeInvalid.Error())
+	}
+	if p.config.UrlPathCheckResponse != (config.UrlPathResponseConfig{}) {
+		resp, err := newPathResponse(p.config.UrlPathCheckResponse, http.StatusBadRequest)
+		if err != nil {
+			sysPrint.PrintlnAndLogWriteFatalMsg("invalid url-path-check-response: " + err.Error())
+		} else {
+			table.response = resp
+		}
+	}
+	for path, rc := range p.config.UrlPathMap {
+		table.paths[path] = rc
+	}
+	table.rebuild(func(path string, err error) {
+		if err == sysPrint.ErrUrlPathResponseInvalid {
+			sysPrint.PrintlnAndLogWriteFatalMsg("invalid response of url path \"" + path + "\": " + err.Error())
+		} else {
+			sysPrint.PrintlnAndLogWriteFatalMsg("invalid url path \"" + path + "\": " + err.Error())
+		}
+	})
+	p.urlPaths.Store(table)
+}
+
+// urlPathTable 获取当前的 URL 路径表，返回的表不会再被修改
+func (p *proxy) urlPathTable() *urlPathTable {
+	return p.urlPaths.Load().(*urlPathTable)
+}
+
+// MatchUrlPath 请求路径是否在 URL 路径表中
+func (p *proxy) MatchUrlPath(path string) bool {
+	_, ok := p.urlPathTable().tree.Match(path)
+	return ok
+}
+
+// checkUrlPath 检查请求路径，返回拒绝请求的响应，允许转发时返回 nil
+// 匹配到设置了响应的路径时总是拒绝；否则允许名单模式拒绝未匹配的路径，拒绝名单模式拒绝匹配的路径
+func (p *proxy) checkUrlPath(path string) *pathResponse {
+	table := p.urlPathTable()
+	v, ok := table.tree.Match(path)
+	if ok {
+		if resp := v.(*pathResponse); resp != nil {
+			return resp
+		}
+	}
+	if ok == table.deny {
+		return table.response
+	}
+	return nil
+}
+
+// UrlPaths 返回排序后的 URL 路径列表
+func (p *proxy) UrlPaths() []string {
+	table := p.urlPathTable()
+	paths := make([]string, 0, len(table.paths))
+	for path := range table.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// AddUrlPath 添加 URL 路径，使用默认的拒绝响应，路径格式同 url-path-map，路径无效或已存在时返回错误
+func (p *proxy) AddUrlPath(path string) error {
+	p.urlPathsMu.Lock()
+	defer p.urlPathsMu.Unlock()
+	old := p.urlPathTable()
+	if _, ok := old.paths[path]; ok {
+		return sysPrint.ErrUrlPathExists
+	}
+	table := old.clone()
+	table.paths[path] = nil
+	var err error
+	table.rebuild(func(k string, e error) {
+		if k == path && err == nil {
+			err = e
+		}
+	})
+	if err != nil {
+		return err
+	}
+	p.urlPaths.Store(table)
+	return nil
+}
+
+// DeleteUrlPath 删除 URL 路径，路径不存在时返回错误
+func (p *proxy) DeleteUrlPath(path string) error {
+	p.urlPathsMu.Lock()
+	defer p.urlPathsMu.Unlock()
+	old := p.urlPathTable()
+	if _, ok := old.paths[path]; !ok {
+		return sysPrint.ErrUrlPathNotExists
+	}
+	table := old.clone()
+	delete(table.paths, path)
+	// 其余路径的无效配置已在初始化时报告
+	table.rebuild(nil)
+	p.urlPaths.Store(table)
+	return nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultConsecutiveFailures = 5                // 默认打开断路器的连续失败次数
+	DefaultBreakerMinRequests  = 20               // 默认计算失败率需要的最小请求数
+	DefaultBreakerWindow       = 10 * time.Second // 默认统计失败率的时间窗口
+	DefaultOpenDuration        = 10 * time.Second // 默认断路器打开的持续时长
+	DefaultHalfOpenRequests    = 1                // 默认半开状态放行的试探请求数
+)
+
+// BreakerState 断路器状态
+type BreakerState int32
+
+const (
+	BreakerClosed   BreakerState = iota // 关闭：请求正常通过
+	BreakerOpen                         // 打开：拒绝所有请求，服务器不再被负载均衡器选择
+	BreakerHalfOpen                     // 半开：放行有限数目的试探请求
+)
+
+func (st BreakerState) String() string {
+	switch st {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerOptions 断路器选项，值为 0 时使用默认值
+// ConsecutiveFailures 与 FailureRate 都为 0 时按默认的连续失败次数打开断路器
+type BreakerOptions struct {
+	ConsecutiveFailures int32         // 连续失败次数达到该值时打开断路器，为 0 时不按连续失败次数打开
+	FailureRate         float64       // 时间窗口内的失败率达到该值（0~1）时打开断路器，为 0 时不按失败率打开
+	MinRequests         int32         // 时间窗口内的请求数达到该值后才计算失败率
+	Window              time.Duration // 统计失败率的时间窗口
+	OpenDuration        time.Duration // 断路器打开的持续时长，之后进入半开状态
+	HalfOpenRequests    int32         // 半开状态放行的试探请求数，全部成功后关闭断路器，任意一个失败则重新打开
+}
+
+// Breaker 服务器断路器
+// 关闭状态下连续失败次数或时间窗口内的失败率达到阈值时打开；打开 OpenDuration 后进入半开状态，
+// 放行 HalfOpenRequests 个试探请求，全部成功则关闭，任意一个失败则重新打开
+type Breaker struct {
+	lock        sync.Mutex
+	opts        BreakerOptions
+	state       int32     // BreakerState，供 State 原子读取
+	consecutive int32     // 连续失败次数
+	windowStart time.Time // 当前时间窗口的开始时间
+	requests    int32     // 当前时间窗口内的请求数
+	failures    int32     // 当前时间窗口内的失败数
+	trials      int32     // 半开状态已放行的试探请求数
+	successes   int32     // 半开状态成功的试探请求数
+	onChange    func()    // 断路器打开或进入半开状态（服务器可用性变化）时调用，调用时不持有锁
+}
+
+// NewBreaker 创建一个断路器
+func NewBreaker(opts BreakerOptions) *Breaker {
+	if opts.ConsecutiveFailures <= 0 && opts.FailureRate <= 0 {
+		opts.ConsecutiveFailures = DefaultConsecutiveFailures
+	}
+	if opts.FailureRate > 1 {
+		opts.FailureRate = 1
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultBreakerMinRequests
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultBreakerWindow
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = DefaultOpenDuration
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+	return &Breaker{opts: opts, windowStart: time.Now()}
+}
+
+// State 获取断路器当前状态
+func (b *Breaker) State() BreakerState {
+	return BreakerState(atomic.LoadInt32(&b.state))
+}
+
+// setState 设置断路器状态，调用方需持有锁
+func (b *Breaker) setState(state BreakerState) {
+	atomic.StoreInt32(&b.state, int32(state))
+}
+
+// Allow 是否放行一个请求，半开状态下放行的请求计为试探请求
+func (b *Breaker) Allow() bool {
+	switch b.State() {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if state := b.State(); state != BreakerHalfOpen {
+		return state == BreakerClosed
+	}
+	if b.trials >= b.opts.HalfOpenRequests {
+		return false
+	}
+	b.trials++
+	return true
+}
+
+// OnResult 记录一次请求的结果，failed 表示请求失败（连接错误、超时或 5xx 响应）
+func (b *Breaker) OnResult(failed bool) {
+	b.lock.Lock()
+	opened := false
+	switch b.State() {
+	case BreakerClosed:
+		now := time.Now()
+		if now.Sub(b.windowStart) >= b.opts.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if failed {
+			b.consecutive++
+			b.failures++
+		} else {
+			b.consecutive = 0
+		}
+		if (b.opts.ConsecutiveFailures > 0 && b.consecutive >= b.opts.ConsecutiveFailures) ||
+			(b.opts.FailureRate > 0 && b.requests >= b.opts.MinRequests &&
+				float64(b.failures) >= float64(b.requests)*b.opts.FailureRate) {
+			b.open()
+			opened = true
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.open()
+			opened = true
+			break
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			b.reset()
+			b.setState(BreakerClosed)
+		}
+	}
+	b.lock.Unlock()
+	if opened && b.onChange != nil {
+		b.onChange()
+	}
+}
+
+// open 打开断路器，OpenDuration 后进入半开状态，调用方需持有锁
+func (b *Breaker) open() {
+	b.setState(BreakerOpen)
+	time.AfterFunc(b.opts.OpenDuration, b.halfOpen)
+}
+
+// halfOpen 断路器进入半开状态
+func (b *Breaker) halfOpen() {
+	b.lock.Lock()
+	if b.State() != BreakerOpen {
+		b.lock.Unlock()
+		return
+	}
+	b.trials, b.successes = 0, 0
+	b.setState(BreakerHalfOpen)
+	b.lock.Unlock()
+	if b.onChange != nil {
+		b.onChange()
+	}
+}
+
+// reset 重置失败统计，调用方需持有锁
+func (b *Breaker) reset() {
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.windowStart = time.Now()
+}
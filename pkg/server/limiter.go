@@ -0,0 +1,100 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultInitialLimit = 20   // 默认初始并发限制
+	DefaultMinLimit     = 1    // 默认最小并发限制
+	DefaultMaxLimit     = 1000 // 默认最大并发限制
+	DefaultTolerance    = 2.0  // 默认延迟容忍倍数
+	DefaultBackoff      = 0.9  // 默认过载时并发限制的缩减比例
+
+	// minRTTResetSamples 每经过该数目的样本重新测量最小延迟，使限制器能适应服务器性能的长期变化
+	minRTTResetSamples = 1000
+)
+
+// LimiterOptions 自适应并发限制器选项，值为 0 时使用默认值
+type LimiterOptions struct {
+	InitialLimit int32   // 初始并发限制
+	MinLimit     int32   // 最小并发限制
+	MaxLimit     int32   // 最大并发限制
+	Tolerance    float64 // 响应延迟超过 最小延迟 * Tolerance 时认为服务器过载
+	Backoff      float64 // 过载时并发限制乘以该比例
+}
+
+// Limiter AIMD 自适应并发限制器
+// 根据观测到的响应延迟调整服务器的并发限制：请求失败或响应延迟超过最小延迟的 Tolerance 倍时，限制乘以 Backoff（乘性减）；
+// 否则在并发请求数达到限制的一半以上时，每个样本使限制增加 1/limit，即每轮请求约增加 1（加性增）
+type Limiter struct {
+	lock     sync.Mutex
+	limit    float64
+	minRTT   time.Duration // 当前测量周期内观测到的最小延迟，为 0 表示尚无样本
+	samples  int           // 当前测量周期内的样本数
+	opts     LimiterOptions
+	limitInt int32 // limit 取整后的值，供 Limit 原子读取
+}
+
+// NewLimiter 创建一个 AIMD 自适应并发限制器
+func NewLimiter(opts LimiterOptions) *Limiter {
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = DefaultMinLimit
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = DefaultMaxLimit
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.InitialLimit <= 0 {
+		opts.InitialLimit = DefaultInitialLimit
+	}
+	if opts.InitialLimit < opts.MinLimit {
+		opts.InitialLimit = opts.MinLimit
+	}
+	if opts.InitialLimit > opts.MaxLimit {
+		opts.InitialLimit = opts.MaxLimit
+	}
+	if opts.Tolerance <= 1 {
+		opts.Tolerance = DefaultTolerance
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = DefaultBackoff
+	}
+	return &Limiter{
+		limit:    float64(opts.InitialLimit),
+		opts:     opts,
+		limitInt: opts.InitialLimit,
+	}
+}
+
+// Limit 获取当前并发限制
+func (l *Limiter) Limit() int32 {
+	return atomic.LoadInt32(&l.limitInt)
+}
+
+// OnSample 根据一次请求的响应延迟调整并发限制
+// inflight 为该请求发出时（含该请求）的并发请求数，dropped 表示请求因服务器过载或故障失败
+func (l *Limiter) OnSample(rtt time.Duration, inflight int32, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.samples++
+	if l.samples > minRTTResetSamples {
+		l.samples, l.minRTT = 1, 0
+	}
+	if !dropped && (l.minRTT == 0 || rtt < l.minRTT) {
+		l.minRTT = rtt
+	}
+
+	if dropped || float64(rtt) > float64(l.minRTT)*l.opts.Tolerance {
+		l.limit = math.Max(float64(l.opts.MinLimit), l.limit*l.opts.Backoff)
+	} else if float64(inflight)*2 >= l.limit {
+		l.limit = math.Min(float64(l.opts.MaxLimit), l.limit+1/l.limit)
+	}
+	atomic.StoreInt32(&l.limitInt, int32(l.limit))
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"EH-Proxy/pkg/system/sysPrint"
 	"context"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -17,8 +19,40 @@ const (
 	NOT_PFAIL     = int32(0)
 	DefaultWeight = 100
 	MaxWeight     = 1000000
+
+	// LatencyDecayTime 响应延迟 EWMA 的衰减时间常数，越大则历史样本的影响越持久
+	LatencyDecayTime = 10 * time.Second
+
+	// FailureLatency 失败请求计入的响应延迟样本（惩罚值），避免快速失败的服务器因延迟小而获得更多请求
+	FailureLatency = 10 * time.Second
+
+	// SlowStartMinFactor 慢启动开始时有效权重占权重的比例
+	SlowStartMinFactor = 0.1
+
+	// DefaultPriority 默认优先级，数值越小优先级越高
+	DefaultPriority = int32(0)
+
+	// BackupPriority 备用服务器的优先级，低于所有普通优先级
+	BackupPriority = int32(math.MaxInt32)
+)
+
+// ChangeType 服务器状态变更类型
+type ChangeType int
+
+const (
+	WeightChanged  ChangeType = iota // 权重变更
+	PfailChanged                     // 主观下线或恢复上线
+	DrainChanged                     // 排空状态变更
+	BreakerChanged                   // 断路器打开或进入半开状态
+	EjectChanged                     // 被异常检测驱逐或恢复
 )
 
+// Observer 服务器状态变更观察者，服务器的权重、主观下线状态、排空状态、断路器状态或驱逐状态发生变化时调用 OnServerUpdate
+// OnServerUpdate 在修改状态的 goroutine 中同步调用，实现中不应再修改该服务器的状态
+type Observer interface {
+	OnServerUpdate(s *Server, change ChangeType)
+}
+
 // Server EasyProxy 所代理的服务器
 // 目前仅支持代理 HTTP
 type Server struct {
@@ -29,6 +63,18 @@ type Server struct {
 	lastAck         time.Duration // 上次回复时间
 	activeReq       int32         // 活跃请求数
 	pfail           int32         // 主观下线状态
+	latencyEWMA     float64       // 响应延迟的 Peak EWMA（纳秒）
+	latencyLast     float64       // 最近一次响应延迟样本（纳秒），没有新样本时 latencyEWMA 向该值衰减
+	latencyStamp    int64         // 上次更新 latencyEWMA 的时间戳（纳秒）
+	latencyLock     sync.Mutex    // latencyEWMA、latencyLast 与 latencyStamp 的互斥锁
+	slowStart       time.Duration // 慢启动时长，为 0 则不进行慢启动
+	slowStartBegin  int64         // 慢启动开始时间戳（纳秒），为 0 表示不处于慢启动阶段
+	priority        int32         // 优先级，数值越小优先级越高
+	drain           int32         // 排空状态，排空中的服务器不再被负载均衡器选择
+	ejected         int32         // 驱逐状态，被异常检测驱逐的服务器在驱逐期间不再被负载均衡器选择
+	observer        Observer      // 状态变更观察者
+	limiter         *Limiter      // 自适应并发限制器，为 nil 表示不限制
+	breaker         *Breaker      // 断路器，为 nil 表示不使用断路器
 }
 
 func (s *Server) StopHealthCheck() chan struct{} {
@@ -88,12 +134,78 @@ func (s *Server) SetWeight(weight int32) error {
 	if err != nil {
 		return err
 	}
-	atomic.StoreInt32(&s.weight, weight)
+	if atomic.SwapInt32(&s.weight, weight) != weight {
+		s.notify(WeightChanged)
+	}
 	return nil
 }
 
+// SetObserver 设置状态变更观察者，需在服务器被其他 goroutine 访问之前调用
+func (s *Server) SetObserver(observer Observer) {
+	s.observer = observer
+}
+
+// notify 通知观察者服务器状态发生变更
+func (s *Server) notify(change ChangeType) {
+	if s.observer != nil {
+		s.observer.OnServerUpdate(s, change)
+	}
+}
+
+// Weight 获取权重，权重为 0 的服务器按最低权重 1 计算
+// 在读取时修正而不是由负载均衡器调用 SetWeight，避免在负载均衡器持有锁时触发状态变更通知
 func (s *Server) Weight() int32 {
-	return atomic.LoadInt32(&s.weight)
+	if weight := atomic.LoadInt32(&s.weight); weight > 1 {
+		return weight
+	}
+	return 1
+}
+
+// EffectiveWeight 获取负载均衡器使用的有效权重
+// 处于慢启动阶段时，有效权重从 权重 * SlowStartMinFactor 随时间线性增长到权重，最小为 1
+func (s *Server) EffectiveWeight() int32 {
+	weight := s.Weight()
+	begin := atomic.LoadInt64(&s.slowStartBegin)
+	if begin == 0 {
+		return weight
+	}
+	elapsed := time.Now().UnixNano() - begin
+	window := int64(s.SlowStart())
+	if elapsed >= window {
+		// 慢启动结束
+		atomic.CompareAndSwapInt64(&s.slowStartBegin, begin, 0)
+		return weight
+	}
+	factor := float64(elapsed) / float64(window)
+	if factor < SlowStartMinFactor {
+		factor = SlowStartMinFactor
+	}
+	effective := int32(float64(weight) * factor)
+	if effective < 1 {
+		effective = 1
+	}
+	return effective
+}
+
+func (s *Server) SlowStart() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&s.slowStart)))
+}
+
+func (s *Server) SetSlowStart(slowStart time.Duration) {
+	atomic.StoreInt64((*int64)(&s.slowStart), int64(slowStart))
+}
+
+// StartSlowStart 开始慢启动，在新服务器加入或服务器恢复上线时调用
+func (s *Server) StartSlowStart() {
+	if s.SlowStart() <= 0 {
+		return
+	}
+	atomic.StoreInt64(&s.slowStartBegin, time.Now().UnixNano())
+}
+
+// InSlowStart 服务器是否处于慢启动阶段
+func (s *Server) InSlowStart() bool {
+	return s.EffectiveWeight() < s.Weight()
 }
 
 func (s *Server) LastAck() time.Duration {
@@ -120,12 +232,184 @@ func (s *Server) DecrActiveReq() {
 	atomic.AddInt32(&s.activeReq, -1)
 }
 
+// SetLimiter 设置自适应并发限制器，需在服务器被其他 goroutine 访问之前调用
+func (s *Server) SetLimiter(limiter *Limiter) {
+	s.limiter = limiter
+}
+
+// ConcurrencyLimit 获取当前并发限制，为 0 表示不限制
+func (s *Server) ConcurrencyLimit() int32 {
+	if s.limiter == nil {
+		return 0
+	}
+	return s.limiter.Limit()
+}
+
+// SetBreaker 设置断路器，需在服务器被其他 goroutine 访问之前调用
+// 断路器打开或进入半开状态时通知观察者，使负载均衡器及时排除或重新加入该服务器
+func (s *Server) SetBreaker(breaker *Breaker) {
+	s.breaker = breaker
+	if breaker != nil {
+		breaker.onChange = func() {
+			s.notify(BreakerChanged)
+		}
+	}
+}
+
+// Breaker 获取断路器，为 nil 表示不使用断路器
+func (s *Server) Breaker() *Breaker {
+	return s.breaker
+}
+
+// BreakerState 获取断路器状态，未使用断路器时总是 BreakerClosed
+func (s *Server) BreakerState() BreakerState {
+	if s.breaker == nil {
+		return BreakerClosed
+	}
+	return s.breaker.State()
+}
+
+// TryAcquire 尝试占用一个并发名额，成功时活跃请求数加 1
+// 活跃请求数已达到并发限制或断路器拒绝请求时返回 false，未设置并发限制器与断路器时总是成功
+func (s *Server) TryAcquire() bool {
+	if !s.tryAcquireSlot() {
+		return false
+	}
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.DecrActiveReq()
+		return false
+	}
+	return true
+}
+
+// tryAcquireSlot 在并发限制内将活跃请求数加 1
+func (s *Server) tryAcquireSlot() bool {
+	if s.limiter == nil {
+		s.IncrActiveReq()
+		return true
+	}
+	limit := s.limiter.Limit()
+	for {
+		active := atomic.LoadInt32(&s.activeReq)
+		if active >= limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.activeReq, active, active+1) {
+			return true
+		}
+	}
+}
+
+// Release 释放 TryAcquire 占用的并发名额，记录响应延迟样本并调整并发限制，失败的请求以 FailureLatency 作为延迟样本
+// dropped 表示请求因服务器过载或故障失败
+func (s *Server) Release(rtt time.Duration, dropped bool) {
+	s.ReleaseResult(rtt, dropped, dropped)
+}
+
+// ReleaseResult 同 Release，failed 表示请求失败（连接错误、超时或 5xx 响应），计入断路器的失败统计
+func (s *Server) ReleaseResult(rtt time.Duration, dropped, failed bool) {
+	inflight := atomic.AddInt32(&s.activeReq, -1) + 1
+	if failed && rtt < FailureLatency {
+		s.RecordLatency(FailureLatency)
+	} else {
+		s.RecordLatency(rtt)
+	}
+	if s.limiter != nil {
+		s.limiter.OnSample(rtt, inflight, dropped)
+	}
+	if s.breaker != nil {
+		s.breaker.OnResult(failed)
+	}
+}
+
 func (s *Server) Pfail() int32 {
 	return atomic.LoadInt32(&s.pfail)
 }
 
 func (s *Server) SetPfail(pfail int32) {
-	atomic.StoreInt32(&s.pfail, pfail)
+	if atomic.SwapInt32(&s.pfail, pfail) != pfail {
+		s.notify(PfailChanged)
+	}
+}
+
+// Available 服务器是否可以被负载均衡器选择（未被主观认为下线、未排空、未被驱逐且断路器未打开）
+func (s *Server) Available() bool {
+	return s.Pfail() == NOT_PFAIL && !s.Draining() && !s.Ejected() && s.BreakerState() != BreakerOpen
+}
+
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.drain) != 0
+}
+
+// SetDrain 设置排空状态，排空中的服务器不再接收新请求，已有请求不受影响
+func (s *Server) SetDrain(drain bool) {
+	var v int32
+	if drain {
+		v = 1
+	}
+	if atomic.SwapInt32(&s.drain, v) != v {
+		s.notify(DrainChanged)
+	}
+}
+
+func (s *Server) Ejected() bool {
+	return atomic.LoadInt32(&s.ejected) != 0
+}
+
+// SetEjected 设置驱逐状态，被驱逐的服务器不再接收新请求，已有请求不受影响
+func (s *Server) SetEjected(ejected bool) {
+	var v int32
+	if ejected {
+		v = 1
+	}
+	if atomic.SwapInt32(&s.ejected, v) != v {
+		s.notify(EjectChanged)
+	}
+}
+
+func (s *Server) Priority() int32 {
+	return atomic.LoadInt32(&s.priority)
+}
+
+// SetPriority 设置优先级，优先级分层由负载均衡器在添加节点时确定，需在添加到负载均衡器之前设置
+func (s *Server) SetPriority(priority int32) {
+	atomic.StoreInt32(&s.priority, priority)
+}
+
+// IsBackup 是否为备用服务器
+func (s *Server) IsBackup() bool {
+	return s.Priority() == BackupPriority
+}
+
+// RecordLatency 记录一次请求的响应延迟样本
+// Peak EWMA：样本大于当前值时直接取样本值，使延迟突增能被立即感知；否则按距上次更新的时间进行指数衰减平滑
+func (s *Server) RecordLatency(rtt time.Duration) {
+	now := time.Now().UnixNano()
+	s.latencyLock.Lock()
+	defer s.latencyLock.Unlock()
+	sample := float64(rtt)
+	if sample > s.latencyEWMA {
+		s.latencyEWMA = sample
+	} else {
+		w := math.Exp(-float64(now-s.latencyStamp) / float64(LatencyDecayTime))
+		s.latencyEWMA = s.latencyEWMA*w + sample*(1-w)
+	}
+	s.latencyLast = sample
+	s.latencyStamp = now
+}
+
+// LatencyEWMA 获取当前的响应延迟 Peak EWMA，长时间没有新样本时该值会逐渐衰减到最近一次的延迟样本
+// 空闲的慢节点不会因此被误认为变快
+func (s *Server) LatencyEWMA() time.Duration {
+	now := time.Now().UnixNano()
+	s.latencyLock.Lock()
+	defer s.latencyLock.Unlock()
+	elapsed := now - s.latencyStamp
+	if elapsed <= 0 {
+		return time.Duration(s.latencyEWMA)
+	}
+	w := math.Exp(-float64(elapsed) / float64(LatencyDecayTime))
+	return time.Duration(s.latencyLast + (s.latencyEWMA-s.latencyLast)*w)
 }
 
 // HeartBeat 对 probe 发送 GET 请求以检测服务器健康状况
@@ -0,0 +1,321 @@
+package AliasLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"math/rand"
+	"sync"
+)
+
+const (
+	DEFAULT_SLOW_START_RETRY = 3   // 选中慢启动节点被拒绝时的默认最大重新选择次数
+	REBUILD_THRESHOLD        = 0.2 // 重建阈值（别名表中被排除的权重与待加入权重之和/别名表总权重）
+	MAX_PENDING              = 16  // 待加入节点列表的最大长度，超过后重建别名表
+	maxPickRetry             = 64  // 从别名表中选中被排除节点时的最大重新选择次数
+)
+
+// aliasTable Walker/Vose 别名表，以 O(1) 时间按权重随机选择节点
+// 第 i 列以 prob[i]/total 的概率选择 nodes[i]，否则选择 nodes[alias[i]]
+type aliasTable struct {
+	nodes    []*server.Server // 构建时的可用节点
+	weights  []int64          // 构建时各节点的权重
+	prob     []int64          // 各列选择本列节点的阈值，取值范围 0 ~ total
+	alias    []int            // 各列的别名节点索引
+	excluded []bool           // 构建后被删除、权重变更或变为不可用的节点，选中时重新选择
+	total    int64            // 构建时可用节点权重和
+}
+
+// ALLB Alias Load Balancer
+// 使用别名表进行加权随机选择，选择时间复杂度为 O(1)。别名表增量维护：
+// 节点被删除、权重变更或变为不可用时在别名表中将其排除（选中时重新选择），新加入、权重变更或恢复可用的节点
+// 先放入待加入列表，按其权重和占比直接从列表中选择；被排除的权重与待加入的权重之和超过别名表总权重的 REBUILD_THRESHOLD，
+// 或待加入列表长度超过 MAX_PENDING 时以 O(n) 重建别名表
+type ALLB struct {
+	serverList    []*server.Server       // 服务器列表（包含不可用节点）
+	serverMap     map[*server.Server]int // Key-value: server-serverList索引 哈希表
+	table         *aliasTable            // 别名表
+	tableIndex    map[*server.Server]int // Key-value: server-别名表节点索引 哈希表
+	excludeWeight int64                  // 别名表中被排除节点的权重和
+	pending       []*server.Server       // 待加入别名表的可用节点
+	pendingWeight []int64                // 待加入节点的权重
+	pendingTotal  int64                  // 待加入节点的权重和
+	maxRetry      int                    // 选中慢启动节点被拒绝时的最大重新选择次数
+	rwLock        sync.RWMutex           // 读写锁
+}
+
+// CreateALLB 创建一个 Alias Load Balancer
+func CreateALLB() *ALLB {
+	return CreateALLBWithMaxRetry(DEFAULT_SLOW_START_RETRY)
+}
+
+// CreateALLBWithMaxRetry 创建一个 Alias Load Balancer，并指定选中慢启动节点被拒绝时的最大重新选择次数
+func CreateALLBWithMaxRetry(maxRetry int) *ALLB {
+	if maxRetry < 0 {
+		maxRetry = DEFAULT_SLOW_START_RETRY
+	}
+	lb := &ALLB{
+		maxRetry: maxRetry,
+		rwLock:   sync.RWMutex{},
+	}
+	lb.reset()
+	return lb
+}
+
+// reset 清空所有节点，调用方需持有写锁
+func (lb *ALLB) reset() {
+	lb.serverList = make([]*server.Server, 0)
+	lb.serverMap = make(map[*server.Server]int, 0)
+	lb.table = &aliasTable{}
+	lb.tableIndex = make(map[*server.Server]int, 0)
+	lb.excludeWeight = 0
+	lb.pending = make([]*server.Server, 0)
+	lb.pendingWeight = make([]int64, 0)
+	lb.pendingTotal = 0
+}
+
+// Reset 重置负载均衡器
+func (lb *ALLB) Reset() {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.reset()
+}
+
+// AddServerNode 向负载均衡器添加一个服务器节点
+func (lb *ALLB) AddServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	lb.serverList = append(lb.serverList, serverNode)
+	lb.serverMap[serverNode] = len(lb.serverList) - 1
+	lb.include(serverNode)
+	lb.maybeRebuild()
+	return nil
+}
+
+// DeleteServerNode 从负载均衡器中删除一个服务器节点，将最后一个节点移动到被删除节点的位置
+func (lb *ALLB) DeleteServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	idx, ok := lb.serverMap[serverNode]
+	if !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	last := len(lb.serverList) - 1
+	lb.serverList[idx] = lb.serverList[last]
+	lb.serverMap[lb.serverList[idx]] = idx
+	lb.serverList[last] = nil
+	lb.serverList = lb.serverList[:last]
+	delete(lb.serverMap, serverNode)
+	lb.exclude(serverNode)
+	lb.maybeRebuild()
+	return nil
+}
+
+// InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化，只构建一次别名表
+func (lb *ALLB) InitServerNode(serverNodeList []*server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.reset()
+	for _, s := range serverNodeList {
+		if _, ok := lb.serverMap[s]; ok {
+			lb.rebuild()
+			return sysPrint.ErrServerExists
+		}
+		lb.serverList = append(lb.serverList, s)
+		lb.serverMap[s] = len(lb.serverList) - 1
+	}
+	lb.rebuild()
+	return nil
+}
+
+// OnServerUpdate 服务器权重或可用状态变更后，将节点从别名表中排除，仍可用时按新权重放入待加入列表
+func (lb *ALLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; !ok {
+		return
+	}
+	lb.exclude(serverNode)
+	lb.include(serverNode)
+	lb.maybeRebuild()
+}
+
+// include 节点可用时将其放入待加入列表，调用方需持有写锁
+func (lb *ALLB) include(serverNode *server.Server) {
+	w := int64(serverNode.Weight())
+	if !serverNode.Available() || w <= 0 {
+		return
+	}
+	lb.pending = append(lb.pending, serverNode)
+	lb.pendingWeight = append(lb.pendingWeight, w)
+	lb.pendingTotal += w
+}
+
+// exclude 将节点从别名表中排除并从待加入列表中移除，调用方需持有写锁
+func (lb *ALLB) exclude(serverNode *server.Server) {
+	if idx, ok := lb.tableIndex[serverNode]; ok {
+		delete(lb.tableIndex, serverNode)
+		lb.table.excluded[idx] = true
+		lb.excludeWeight += lb.table.weights[idx]
+	}
+	for i, s := range lb.pending {
+		if s == serverNode {
+			lb.pendingTotal -= lb.pendingWeight[i]
+			last := len(lb.pending) - 1
+			lb.pending[i], lb.pendingWeight[i] = lb.pending[last], lb.pendingWeight[last]
+			lb.pending[last] = nil
+			lb.pending, lb.pendingWeight = lb.pending[:last], lb.pendingWeight[:last]
+			return
+		}
+	}
+}
+
+// maybeRebuild 被排除与待加入的权重超过阈值或待加入列表过长时重建别名表，调用方需持有写锁
+func (lb *ALLB) maybeRebuild() {
+	if len(lb.pending) > MAX_PENDING ||
+		float64(lb.excludeWeight+lb.pendingTotal) > float64(lb.table.total)*REBUILD_THRESHOLD {
+		lb.rebuild()
+	}
+}
+
+// rebuild 根据服务器列表中可用节点当前的权重重建别名表，并清空待加入列表，调用方需持有写锁
+func (lb *ALLB) rebuild() {
+	lb.table = buildAliasTable(lb.serverList)
+	lb.tableIndex = make(map[*server.Server]int, len(lb.table.nodes))
+	for i, s := range lb.table.nodes {
+		lb.tableIndex[s] = i
+	}
+	lb.excludeWeight = 0
+	lb.pending = lb.pending[:0]
+	lb.pendingWeight = lb.pendingWeight[:0]
+	lb.pendingTotal = 0
+}
+
+// buildAliasTable 使用 Vose 算法根据服务器列表中可用节点的权重构建别名表，时间复杂度 O(n)
+// 所有权重放大 n 倍后以整数计算，避免浮点误差
+func buildAliasTable(serverList []*server.Server) *aliasTable {
+	t := &aliasTable{
+		nodes:   make([]*server.Server, 0, len(serverList)),
+		weights: make([]int64, 0, len(serverList)),
+	}
+	for _, s := range serverList {
+		if w := int64(s.Weight()); s.Available() && w > 0 {
+			t.nodes = append(t.nodes, s)
+			t.weights = append(t.weights, w)
+			t.total += w
+		}
+	}
+	n := len(t.nodes)
+	t.prob = make([]int64, n)
+	t.alias = make([]int, n)
+	t.excluded = make([]bool, n)
+	small := make([]int, 0, n)
+	large := make([]int, 0, n)
+	for i, w := range t.weights {
+		t.prob[i] = w * int64(n)
+		t.alias[i] = i
+		if t.prob[i] < t.total {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+		t.alias[s] = l
+		t.prob[l] += t.prob[s] - t.total
+		if t.prob[l] < t.total {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+	for _, i := range large {
+		t.prob[i] = t.total
+	}
+	for _, i := range small {
+		t.prob[i] = t.total
+	}
+	return t
+}
+
+// pick 从别名表中随机选择一个节点的索引
+func (t *aliasTable) pick() int {
+	n := int64(len(t.nodes))
+	x := rand.Int63n(n * t.total)
+	col := x / t.total
+	if x%t.total < t.prob[col] {
+		return int(col)
+	}
+	return t.alias[col]
+}
+
+// pick 按权重从别名表未被排除的节点与待加入节点中随机选择一个节点，没有节点时返回 nil，调用方需持有读锁
+func (lb *ALLB) pick() *server.Server {
+	live := lb.table.total - lb.excludeWeight
+	if live+lb.pendingTotal <= 0 {
+		return nil
+	}
+	if lb.pendingTotal > 0 {
+		if r := rand.Int63n(live + lb.pendingTotal); r >= live {
+			r -= live
+			for i, w := range lb.pendingWeight {
+				if r < w {
+					return lb.pending[i]
+				}
+				r -= w
+			}
+		}
+	}
+
+	// 被排除的权重不超过总权重的 REBUILD_THRESHOLD，期望重新选择次数小于 1/(1-REBUILD_THRESHOLD)
+	for i := 0; i < maxPickRetry; i++ {
+		if idx := lb.table.pick(); !lb.table.excluded[idx] {
+			return lb.table.nodes[idx]
+		}
+	}
+	for i, s := range lb.table.nodes {
+		if !lb.table.excluded[i] {
+			return s
+		}
+	}
+	return nil
+}
+
+// SelectNode 使用别名表加权随机选取一个服务器节点
+// 处于慢启动阶段的节点以 有效权重/权重 的概率接受选择，达到最大重新选择次数后接受最后被拒绝的节点；
+// 服务器状态变更未通知负载均衡器导致选中不可用节点时，遍历服务器列表查找可用节点，只要存在可用节点就不会返回错误
+func (lb *ALLB) SelectNode() (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	var candidate *server.Server // 被拒绝的慢启动节点
+	for i := 0; i <= lb.maxRetry; i++ {
+		s := lb.pick()
+		if s == nil || !s.Available() {
+			break
+		}
+		if weight, effective := s.Weight(), s.EffectiveWeight(); effective < weight &&
+			rand.Int31n(weight) >= effective {
+			candidate = s
+			continue
+		}
+		return s, nil
+	}
+	if candidate != nil {
+		return candidate, nil
+	}
+
+	if len(lb.serverList) == 0 {
+		return nil, sysPrint.ErrNoServer
+	}
+	idx := rand.Intn(len(lb.serverList))
+	for i := 0; i < len(lb.serverList); i++ {
+		s := lb.serverList[(idx+i)%len(lb.serverList)]
+		if s.Available() {
+			return s, nil
+		}
+	}
+	return nil, sysPrint.ErrNoServer
+}
@@ -0,0 +1,120 @@
+package AliasLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb/RandomLB"
+	"log"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+const (
+	serverNum = 1000
+	testHost  = "127.0.0.1"
+	maxWeight = 400
+)
+
+var (
+	testServerPort = 10001
+)
+
+// benchmarkLoadBalancer 别名表与前缀和随机负载均衡器共有的方法
+type benchmarkLoadBalancer interface {
+	AddServerNode(*server.Server) error
+	DeleteServerNode(*server.Server) error
+	SelectNode() (*server.Server, error)
+	OnServerUpdate(*server.Server, server.ChangeType)
+}
+
+func createBenchmarkServers(b *testing.B, lb benchmarkLoadBalancer) []*server.Server {
+	servers := make([]*server.Server, 0, serverNum)
+	for i := 0; i < serverNum; i++ {
+		addr := testHost + ":" + strconv.Itoa(testServerPort)
+		testServerPort++
+		s, err := server.NewServer(addr, int32(rand.Intn(maxWeight)+1), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = lb.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+	return servers
+}
+
+func benchmarkSelectNode(b *testing.B, lb benchmarkLoadBalancer) {
+	createBenchmarkServers(b, lb)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := lb.SelectNode()
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+// benchmarkSelectNodeMostlyFailed 90% 的节点主观下线
+func benchmarkSelectNodeMostlyFailed(b *testing.B, lb benchmarkLoadBalancer) {
+	servers := createBenchmarkServers(b, lb)
+	for i, s := range servers {
+		if i%10 != 0 {
+			s.SetPfail(server.IS_PFAIL)
+			lb.OnServerUpdate(s, server.PfailChanged)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := lb.SelectNode()
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+// benchmarkDeleteAndSelect 交替删除、重新添加节点与选择节点
+func benchmarkDeleteAndSelect(b *testing.B, lb benchmarkLoadBalancer) {
+	servers := createBenchmarkServers(b, lb)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := servers[rand.Intn(len(servers))]
+		err := lb.DeleteServerNode(s)
+		if err != nil {
+			b.Error(err)
+		}
+		_, err = lb.SelectNode()
+		if err != nil {
+			b.Error(err)
+		}
+		err = lb.AddServerNode(s)
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkSelectNode(b *testing.B) {
+	benchmarkSelectNode(b, CreateALLB())
+}
+
+func BenchmarkSelectNodeRDLB(b *testing.B) {
+	benchmarkSelectNode(b, RandomLB.CreateRDLB())
+}
+
+func BenchmarkSelectNodeMostlyFailed(b *testing.B) {
+	benchmarkSelectNodeMostlyFailed(b, CreateALLB())
+}
+
+func BenchmarkSelectNodeMostlyFailedRDLB(b *testing.B) {
+	benchmarkSelectNodeMostlyFailed(b, RandomLB.CreateRDLB())
+}
+
+func BenchmarkDeleteAndSelect(b *testing.B) {
+	benchmarkDeleteAndSelect(b, CreateALLB())
+}
+
+func BenchmarkDeleteAndSelectRDLB(b *testing.B) {
+	benchmarkDeleteAndSelect(b, RandomLB.CreateRDLB())
+}
@@ -0,0 +1,271 @@
+package AliasLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"log"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	AllowableErrorRange = 0.005
+	SelectNodeTestCount = 1000000
+	DeleteNodeTestCount = 100000
+)
+
+var (
+	testServerMap  = map[string]int32{"127.0.0.1:10001": 1, "127.0.0.1:10002": 4, "127.0.0.1:10003": 2, "127.0.0.1:10004": 3, "127.0.0.1:10005": 5}
+	testServerList = make([]*server.Server, 0)
+	serverCount    = len(testServerMap)
+	loadBalancer   *ALLB
+)
+
+func init() {
+	loadBalancer = CreateALLB()
+}
+
+// IsValid 检查 checkNum 是否在 expectNum 的允许误差范围内，是则返回 true
+func IsValid(checkNum, expectNum float64) bool {
+	return checkNum <= expectNum+AllowableErrorRange && checkNum >= expectNum-AllowableErrorRange
+}
+
+// checkDistribution 检查各服务器被选中的概率与权重成正比
+func checkDistribution(t *testing.T, lb *ALLB, servers []*server.Server) {
+	var sum float64
+	for _, s := range servers {
+		sum += float64(s.Weight())
+	}
+	m := make(map[*server.Server]int, 0)
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[s]++
+	}
+	for _, s := range servers {
+		expect := float64(s.Weight()) / sum
+		actual := float64(m[s]) / SelectNodeTestCount
+		if !IsValid(actual, expect) {
+			t.Errorf("The difference between actual probability and expected probability exceeds %.3f, server address: %s ,weight:%d, expect:%.3f, actual:%.3f",
+				AllowableErrorRange, s.Addr(), s.Weight(), expect, actual)
+		}
+	}
+}
+
+func TestAddServerNode(t *testing.T) {
+	for addr, weight := range testServerMap {
+		s, err := server.NewServer(addr, weight, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testServerList = append(testServerList, s)
+	}
+
+	err := loadBalancer.AddServerNode(testServerList[0])
+	if err == nil {
+		t.Error("Adding the same node repeatedly should fail.")
+	}
+
+	// test InitServerNode
+	err = loadBalancer.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(loadBalancer.serverList) != serverCount {
+		t.Errorf("server count error, expect:%d, actual:%d", serverCount, len(loadBalancer.serverList))
+	}
+}
+
+func TestSelectNode(t *testing.T) {
+	checkDistribution(t, loadBalancer, testServerList)
+
+	failIdx := rand.Intn(serverCount)
+	failServer := testServerList[failIdx]
+	failServer.SetPfail(server.IS_PFAIL)
+	loadBalancer.OnServerUpdate(failServer, server.PfailChanged)
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := loadBalancer.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		if s == failServer {
+			t.Fatalf("Selected servers that are considered subjective fail. addr:%s", s.Addr())
+		}
+	}
+	failServer.SetPfail(server.NOT_PFAIL)
+	loadBalancer.OnServerUpdate(failServer, server.PfailChanged)
+	checkDistribution(t, loadBalancer, testServerList)
+}
+
+func TestOnServerUpdate(t *testing.T) {
+	lb := CreateALLB()
+	servers := make([]*server.Server, 0)
+	for i := 0; i < 4; i++ {
+		s, err := server.NewServer("127.0.0.1:"+strconv.Itoa(30001+i), 100, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+	err := lb.InitServerNode(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 权重变更后立即按新权重选择
+	err = servers[0].SetWeight(500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.OnServerUpdate(servers[0], server.WeightChanged)
+	checkDistribution(t, lb, servers)
+
+	// 排空的节点不再被选中
+	servers[1].SetDrain(true)
+	lb.OnServerUpdate(servers[1], server.DrainChanged)
+	checkDistribution(t, lb, []*server.Server{servers[0], servers[2], servers[3]})
+	servers[1].SetDrain(false)
+	lb.OnServerUpdate(servers[1], server.DrainChanged)
+	checkDistribution(t, lb, servers)
+}
+
+// TestSelectNodeMostlyFailed 绝大多数节点不可用时，只要存在可用节点就总能选中
+func TestSelectNodeMostlyFailed(t *testing.T) {
+	lb := CreateALLB()
+	servers := make([]*server.Server, 0)
+	for i := 0; i < 1000; i++ {
+		s, err := server.NewServer("127.0.0.1:"+strconv.Itoa(40001+i), int32(rand.Intn(400)+1), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+	err := lb.InitServerNode(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy := servers[rand.Intn(len(servers))]
+	for _, s := range servers {
+		if s != healthy {
+			s.SetPfail(server.IS_PFAIL)
+			lb.OnServerUpdate(s, server.PfailChanged)
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != healthy {
+			t.Fatalf("select node error, expect:%s, actual:%s", healthy.Addr(), s.Addr())
+		}
+	}
+
+	// 未通知负载均衡器的状态变更也不会选中不可用节点
+	healthy.SetPfail(server.IS_PFAIL)
+	other := servers[0]
+	if other == healthy {
+		other = servers[1]
+	}
+	other.SetPfail(server.NOT_PFAIL)
+	for i := 0; i < 10000; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != other {
+			t.Fatalf("select node error, expect:%s, actual:%s", other.Addr(), s.Addr())
+		}
+	}
+
+	other.SetPfail(server.IS_PFAIL)
+	_, err = lb.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Errorf("expect ErrNoServer, actual:%v", err)
+	}
+}
+
+func TestDeleteServerNode(t *testing.T) {
+	for k := 0; k < DeleteNodeTestCount; k++ {
+		DelIdx := rand.Intn(serverCount)
+		err := loadBalancer.DeleteServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+		for i := 0; i < serverCount; i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() == testServerList[DelIdx].Addr() {
+				t.Errorf("Selected server that is deleted. addr:%s", s.Addr())
+			}
+		}
+
+		err = loadBalancer.AddServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	checkDistribution(t, loadBalancer, testServerList)
+
+	// 删除所有节点
+	for i := 0; i < serverCount; i++ {
+		err := loadBalancer.DeleteServerNode(testServerList[i])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	err := loadBalancer.DeleteServerNode(testServerList[0])
+	if err != sysPrint.ErrServerNotExists {
+		t.Errorf("expect ErrServerNotExists, actual:%v", err)
+	}
+	_, err = loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+}
+
+func TestSelectNodeSlowStart(t *testing.T) {
+	lb := CreateALLB()
+	warm, err := server.NewServer("127.0.0.1:20001", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold, err := server.NewServer("127.0.0.1:20002", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold.SetSlowStart(time.Hour)
+	cold.StartSlowStart()
+	err = lb.InitServerNode([]*server.Server{warm, cold})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 慢启动节点被选中的概率应接近与有效权重成正比（重新选择次数有限，略高于比例）
+	cnt := 0
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		if s == cold {
+			cnt++
+		}
+	}
+	effective := float64(cold.EffectiveWeight())
+	expect := effective / (effective + float64(warm.Weight()))
+	actual := float64(cnt) / SelectNodeTestCount
+	if actual > expect+0.1 || actual < expect-0.02 {
+		t.Errorf("server in slow start, expect:%.3f, actual:%.3f", expect, actual)
+	}
+}
@@ -0,0 +1,199 @@
+// Ketama Consistent Hash Load Balance
+
+package ConsistentHashLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"crypto/md5"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	DEFAULT_VIRTUAL_NODES = 160   // 权重为 server.DefaultWeight 时服务器对应的虚拟节点数
+	MAX_VIRTUAL_NODES     = 16000 // 单个服务器虚拟节点数上限
+	POINTS_PER_HASH       = 4     // 每次 md5 计算产生的虚拟节点数（ketama）
+)
+
+// virtualNode 哈希环上的虚拟节点
+type virtualNode struct {
+	hash   uint32
+	server *server.Server
+}
+
+// CHLB Consistent Hash Load Balancer
+type CHLB struct {
+	ring         []virtualNode               // 哈希环，按 hash 升序排列
+	serverMap    map[*server.Server]struct{} // 服务器集合
+	rwLock       sync.RWMutex                // 读写锁
+	virtualNodes int                         // 权重为 server.DefaultWeight 时的虚拟节点数
+}
+
+// CreateCHLB 创建一个 Consistent Hash Load Balancer
+func CreateCHLB() *CHLB {
+	return CreateCHLBWithVirtualNodes(DEFAULT_VIRTUAL_NODES)
+}
+
+// CreateCHLBWithVirtualNodes 创建一个 Consistent Hash Load Balancer，并指定权重为 server.DefaultWeight 时的虚拟节点数
+func CreateCHLBWithVirtualNodes(virtualNodes int) *CHLB {
+	if virtualNodes < 1 {
+		virtualNodes = DEFAULT_VIRTUAL_NODES
+	}
+	return &CHLB{
+		ring:         make([]virtualNode, 0),
+		serverMap:    make(map[*server.Server]struct{}, 0),
+		rwLock:       sync.RWMutex{},
+		virtualNodes: virtualNodes,
+	}
+}
+
+// hashKey 计算 key 在哈希环上的位置
+func hashKey(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(digest[0:4])
+}
+
+// virtualNodeCount 根据权重计算服务器的虚拟节点数，结果为 POINTS_PER_HASH 的整数倍
+func (lb *CHLB) virtualNodeCount(weight int32) int {
+	n := int(int64(weight) * int64(lb.virtualNodes) / server.DefaultWeight)
+	if n > MAX_VIRTUAL_NODES {
+		n = MAX_VIRTUAL_NODES
+	}
+	n = (n + POINTS_PER_HASH - 1) / POINTS_PER_HASH * POINTS_PER_HASH
+	if n < POINTS_PER_HASH {
+		n = POINTS_PER_HASH
+	}
+	return n
+}
+
+// serverPoints 生成服务器在哈希环上的全部虚拟节点
+// 每个 md5 摘要切分为 4 段，每段生成一个虚拟节点（ketama 算法）
+func (lb *CHLB) serverPoints(serverNode *server.Server) []virtualNode {
+	n := lb.virtualNodeCount(serverNode.Weight())
+	points := make([]virtualNode, 0, n)
+	for i := 0; i < n/POINTS_PER_HASH; i++ {
+		digest := md5.Sum([]byte(serverNode.Addr() + "-" + strconv.Itoa(i)))
+		for j := 0; j < POINTS_PER_HASH; j++ {
+			points = append(points, virtualNode{
+				hash:   binary.LittleEndian.Uint32(digest[j*4 : j*4+4]),
+				server: serverNode,
+			})
+		}
+	}
+	return points
+}
+
+// Reset 重置负载均衡器
+func (lb *CHLB) Reset() {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.ring = make([]virtualNode, 0)
+	lb.serverMap = make(map[*server.Server]struct{}, 0)
+}
+
+// AddServerNode 向负载均衡器添加一个服务器节点，并将其虚拟节点插入哈希环
+func (lb *CHLB) AddServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	lb.serverMap[serverNode] = struct{}{}
+	lb.ring = append(lb.ring, lb.serverPoints(serverNode)...)
+	sort.Slice(lb.ring, func(i, j int) bool {
+		return lb.ring[i].hash < lb.ring[j].hash
+	})
+	return nil
+}
+
+// DeleteServerNode 从负载均衡器中删除一个服务器节点，并移除其在哈希环上的虚拟节点
+func (lb *CHLB) DeleteServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	delete(lb.serverMap, serverNode)
+	lb.removePoints(serverNode)
+	return nil
+}
+
+// removePoints 移除服务器在哈希环上的全部虚拟节点，调用方需持有写锁
+func (lb *CHLB) removePoints(serverNode *server.Server) {
+	// 原地过滤，剩余虚拟节点仍保持有序
+	ring := lb.ring[:0]
+	for _, vn := range lb.ring {
+		if vn.server != serverNode {
+			ring = append(ring, vn)
+		}
+	}
+	lb.ring = ring
+}
+
+// OnServerUpdate 服务器权重变更后按新权重重新生成其虚拟节点，其他服务器的虚拟节点不受影响
+// 主观下线与排空状态在查找时实时检查，不修改哈希环
+func (lb *CHLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	if change != server.WeightChanged {
+		return
+	}
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; !ok {
+		return
+	}
+	lb.removePoints(serverNode)
+	lb.ring = append(lb.ring, lb.serverPoints(serverNode)...)
+	sort.Slice(lb.ring, func(i, j int) bool {
+		return lb.ring[i].hash < lb.ring[j].hash
+	})
+}
+
+// InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化
+func (lb *CHLB) InitServerNode(serverNodeList []*server.Server) error {
+	lb.Reset()
+	for _, s := range serverNodeList {
+		err := lb.AddServerNode(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectNode 在哈希环上随机选取一个位置，返回其顺时针方向第一个可用的服务器节点
+// 请求没有可用的哈希键时使用，正常情况下应使用 SelectNodeByKey
+func (lb *CHLB) SelectNode() (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	return lb.lookup(rand.Uint32())
+}
+
+// SelectNodeByKey 根据 key 选取一个服务器节点，相同的 key 总是映射到同一个服务器
+// 若该服务器被主观认为下线或排空，则沿哈希环顺时针查找下一个可用的服务器
+func (lb *CHLB) SelectNodeByKey(key string) (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	return lb.lookup(hashKey(key))
+}
+
+// lookup 在哈希环上查找 hash 顺时针方向第一个可用的服务器节点，调用方需持有读锁
+func (lb *CHLB) lookup(hash uint32) (*server.Server, error) {
+	n := len(lb.ring)
+	if n == 0 {
+		return nil, sysPrint.ErrNoServer
+	}
+	idx := sort.Search(n, func(i int) bool {
+		return lb.ring[i].hash >= hash
+	})
+	for i := 0; i < n; i++ {
+		vn := lb.ring[(idx+i)%n]
+		if vn.server.Available() {
+			return vn.server, nil
+		}
+	}
+	return nil, sysPrint.ErrNoServer
+}
@@ -0,0 +1,174 @@
+package ConsistentHashLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"log"
+	"math"
+	"strconv"
+	"testing"
+)
+
+const (
+	AllowableErrorRange = 0.05
+	KeyTestCount        = 100000
+)
+
+var (
+	testServerMap  = map[string]int32{"127.0.0.1:10001": 100, "127.0.0.1:10002": 400, "127.0.0.1:10003": 200, "127.0.0.1:10004": 300, "127.0.0.1:10005": 500}
+	testServerList = make([]*server.Server, 0)
+	serverCount    = len(testServerMap)
+	loadBalancer   *CHLB
+)
+
+func init() {
+	loadBalancer = CreateCHLB()
+}
+
+// selectAll 将 KeyTestCount 个 key 映射到服务器
+func selectAll(t *testing.T) map[string]*server.Server {
+	res := make(map[string]*server.Server, KeyTestCount)
+	for i := 0; i < KeyTestCount; i++ {
+		key := "user-" + strconv.Itoa(i)
+		s, err := loadBalancer.SelectNodeByKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[key] = s
+	}
+	return res
+}
+
+func TestAddServerNode(t *testing.T) {
+	for addr, weight := range testServerMap {
+		s, err := server.NewServer(addr, weight, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testServerList = append(testServerList, s)
+	}
+
+	expected := 0
+	for _, s := range testServerList {
+		expected += loadBalancer.virtualNodeCount(s.Weight())
+	}
+	if len(loadBalancer.ring) != expected {
+		t.Errorf("unequal ring size. expect %d, actual %d", expected, len(loadBalancer.ring))
+	}
+	for i := 1; i < len(loadBalancer.ring); i++ {
+		if loadBalancer.ring[i-1].hash > loadBalancer.ring[i].hash {
+			t.Fatalf("ring is not sorted at index %d", i)
+		}
+	}
+
+	err := loadBalancer.AddServerNode(testServerList[0])
+	if err == nil {
+		t.Error("Adding the same node repeatedly should fail.")
+	}
+
+	// test InitServerNode
+	err = loadBalancer.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(loadBalancer.ring) != expected {
+		t.Errorf("unequal ring size after init. expect %d, actual %d", expected, len(loadBalancer.ring))
+	}
+}
+
+func TestSelectNodeByKey(t *testing.T) {
+	first := selectAll(t)
+	second := selectAll(t)
+	for key, s := range first {
+		if second[key] != s {
+			t.Fatalf("key %s mapped to different servers: %s, %s", key, s.Addr(), second[key].Addr())
+		}
+	}
+
+	// 各服务器分配到的 key 比例应与权重比例相近
+	var weightSum int32
+	for _, s := range testServerList {
+		weightSum += s.Weight()
+	}
+	cnt := make(map[*server.Server]int, 0)
+	for _, s := range first {
+		cnt[s]++
+	}
+	for _, s := range testServerList {
+		expect := float64(s.Weight()) / float64(weightSum)
+		actual := float64(cnt[s]) / KeyTestCount
+		if math.Abs(actual-expect) > AllowableErrorRange {
+			t.Errorf("server %s weight:%d, expect:%.3f, actual:%.3f", s.Addr(), s.Weight(), expect, actual)
+		}
+	}
+
+	// 主观下线的服务器不应被选中，其他 key 的映射不受影响
+	failServer := testServerList[0]
+	failServer.SetPfail(server.IS_PFAIL)
+	for key, s := range selectAll(t) {
+		if s == failServer {
+			t.Fatalf("Selected server that is considered subjective fail. addr:%s", s.Addr())
+		}
+		if first[key] != failServer && first[key] != s {
+			t.Fatalf("key %s remapped from %s to %s", key, first[key].Addr(), s.Addr())
+		}
+	}
+	failServer.SetPfail(server.NOT_PFAIL)
+}
+
+func TestDeleteServerNode(t *testing.T) {
+	before := selectAll(t)
+	delServer := testServerList[len(testServerList)-1]
+	err := loadBalancer.DeleteServerNode(delServer)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 删除服务器后，只有原本映射到该服务器的 key 会被重新映射
+	moved := 0
+	for key, s := range selectAll(t) {
+		if s == delServer {
+			t.Fatalf("Selected server that is deleted. addr:%s", s.Addr())
+		}
+		if before[key] != s {
+			if before[key] != delServer {
+				t.Fatalf("key %s remapped from %s to %s", key, before[key].Addr(), s.Addr())
+			}
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Error("no key was remapped after deleting a server")
+	}
+
+	// 重新添加后映射恢复
+	err = loadBalancer.AddServerNode(delServer)
+	if err != nil {
+		t.Error(err)
+	}
+	for key, s := range selectAll(t) {
+		if before[key] != s {
+			t.Fatalf("key %s mapped to %s, expect %s", key, s.Addr(), before[key].Addr())
+		}
+	}
+
+	// 删除所有节点
+	for i := 0; i < serverCount; i++ {
+		err = loadBalancer.DeleteServerNode(testServerList[i])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	_, err = loadBalancer.SelectNodeByKey("user-0")
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+	_, err = loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+}
@@ -4,55 +4,82 @@ package LeastActiveLB
 
 import (
 	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb/internal/sample"
 	"EH-Proxy/pkg/system/sysPrint"
+	"math/rand"
 	"sync"
 )
 
 const (
-	CHOICES = 2
-	INT_MAX = int32(1<<31 - 1)
+	DEFAULT_MAXRETRY = 3 // 随机采样遇到不可用节点时的最大重试次数
 )
 
 type LALB struct {
-	serverMap     map[*server.Server]struct{}
-	serverMapLock sync.Mutex
+	serverList []*server.Server       // 服务器列表
+	serverMap  map[*server.Server]int // Key-value: server-serverList索引 哈希表
+	rwLock     sync.RWMutex           // 读写锁
+	maxRetry   int                    // 随机采样的最大重试次数
+	fullScan   bool                   // 是否遍历所有节点选择，否则使用 Power of 2 choices 随机采样
 }
 
 // CreateLALB 创建一个 Least Active Load Balancer
+// 每次随机选取两个节点进行比较（Power of 2 choices）
 func CreateLALB() *LALB {
 	return &LALB{
-		serverMap:     make(map[*server.Server]struct{}, 0),
-		serverMapLock: sync.Mutex{},
+		serverList: make([]*server.Server, 0),
+		serverMap:  make(map[*server.Server]int, 0),
+		rwLock:     sync.RWMutex{},
+		maxRetry:   DEFAULT_MAXRETRY,
+		fullScan:   false,
 	}
 }
 
+// CreateWeightedLALB 创建一个遍历所有可用节点的 Least Active Load Balancer
+// 每次选择 活跃请求数/权重 最小的节点，时间复杂度 O(n)
+func CreateWeightedLALB() *LALB {
+	lb := CreateLALB()
+	lb.fullScan = true
+	return lb
+}
+
 // Reset 重置负载均衡器
 func (lb *LALB) Reset() {
-	lb.serverMapLock.Lock()
-	defer lb.serverMapLock.Unlock()
-	lb.serverMap = make(map[*server.Server]struct{}, 0)
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.serverList = make([]*server.Server, 0)
+	lb.serverMap = make(map[*server.Server]int, 0)
 }
 
 // AddServerNode 向负载均衡器添加一个服务器节点
 func (lb *LALB) AddServerNode(serverNode *server.Server) error {
-	lb.serverMapLock.Lock()
-	defer lb.serverMapLock.Unlock()
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
 	if _, ok := lb.serverMap[serverNode]; ok {
 		return sysPrint.ErrServerExists
 	}
-	lb.serverMap[serverNode] = struct{}{}
+	lb.serverList = append(lb.serverList, serverNode)
+	lb.serverMap[serverNode] = len(lb.serverList) - 1
 	return nil
 }
 
 // DeleteServerNode 从负载均衡器中删除一个服务器节点
+// 将最后一个节点移动到被删除节点的位置，时间复杂度 O(1)
 func (lb *LALB) DeleteServerNode(serverNode *server.Server) error {
-	lb.serverMapLock.Lock()
-	defer lb.serverMapLock.Unlock()
-
-	if _, ok := lb.serverMap[serverNode]; !ok {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	idx, ok := lb.serverMap[serverNode]
+	if !ok {
 		return sysPrint.ErrServerNotExists
 	}
 	delete(lb.serverMap, serverNode)
+
+	last := len(lb.serverList) - 1
+	if idx != last {
+		lb.serverList[idx] = lb.serverList[last]
+		lb.serverMap[lb.serverList[idx]] = idx
+	}
+	lb.serverList[last] = nil
+	lb.serverList = lb.serverList[:last]
 	return nil
 }
 
@@ -68,38 +95,81 @@ func (lb *LALB) InitServerNode(serverNodeList []*server.Server) error {
 	return nil
 }
 
+// OnServerUpdate 选择时实时读取服务器的活跃请求数、有效权重与可用状态，无需更新内部数据结构
+func (lb *LALB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+}
+
+// compare 比较两个节点的 活跃请求数/有效权重，a 更小时返回负数，相等返回 0，否则返回正数
+// 交叉相乘避免浮点运算
+func compare(a, b *server.Server) int64 {
+	return int64(a.ActiveReq())*int64(b.EffectiveWeight()) - int64(b.ActiveReq())*int64(a.EffectiveWeight())
+}
+
 // SelectNode 选取一个服务器节点
-// Least Active Load Balancer 每次随机选取两个节点，最终选择连接数更少或权重更高（连接数相同）的一方
+// 选择 活跃请求数/权重 最小的节点，比值相同时按权重比例随机选择其中一个，
+// 因此空闲时请求按权重比例分配，繁忙时优先分配给相对负载最低的节点，处于慢启动阶段的节点使用其有效权重
 func (lb *LALB) SelectNode() (*server.Server, error) {
-	if len(lb.serverMap) == 0 {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	if len(lb.serverList) == 0 {
 		return nil, sysPrint.ErrNoServer
 	}
+	if lb.fullScan {
+		return lb.scan()
+	}
+	return lb.powerOfTwoChoices()
+}
 
-	PendingServers := make([]*server.Server, 0)
-	pending := 0
+// powerOfTwoChoices 随机选取两个不同的可用节点，选择 活跃请求数/权重 更小的一方，调用方需持有读锁
+func (lb *LALB) powerOfTwoChoices() (*server.Server, error) {
+	first := sample.RandomAvailable(lb.serverList, nil, lb.maxRetry)
+	if first == nil {
+		return nil, sysPrint.ErrNoServer
+	}
+	second := sample.RandomAvailable(lb.serverList, first, lb.maxRetry)
+	if second == nil {
+		return first, nil
+	}
+	c := compare(first, second)
+	if c < 0 {
+		return first, nil
+	}
+	if c > 0 {
+		return second, nil
+	}
+	firstWeight := int64(first.EffectiveWeight())
+	if rand.Int63n(firstWeight+int64(second.EffectiveWeight())) < firstWeight {
+		return first, nil
+	}
+	return second, nil
+}
 
-	for s := range lb.serverMap {
-		if s.Pfail() == server.IS_PFAIL {
+// scan 遍历所有可用节点，选择 活跃请求数/权重 最小的节点，调用方需持有读锁
+// 比值相同的节点之间使用加权蓄水池抽样
+func (lb *LALB) scan() (*server.Server, error) {
+	var choiceServer *server.Server
+	var tieWeight int64
+	for _, s := range lb.serverList {
+		if !s.Available() {
 			continue
 		}
-		PendingServers = append(PendingServers, s)
-		pending++
-		if pending == CHOICES {
-			break
+		weight := int64(s.EffectiveWeight())
+		if choiceServer == nil {
+			choiceServer, tieWeight = s, weight
+			continue
 		}
-	}
-	minActive := INT_MAX
-	var choiceServer *server.Server
-	for _, s := range PendingServers {
-		if minActive >= s.ActiveReq() {
-			if minActive == s.ActiveReq() {
-				if choiceServer.Weight() < s.Weight() {
-					choiceServer = s
-				}
-			} else {
+		c := compare(s, choiceServer)
+		if c < 0 {
+			choiceServer, tieWeight = s, weight
+		} else if c == 0 {
+			tieWeight += weight
+			if rand.Int63n(tieWeight) < weight {
 				choiceServer = s
 			}
 		}
 	}
+	if choiceServer == nil {
+		return nil, sysPrint.ErrNoServer
+	}
 	return choiceServer, nil
 }
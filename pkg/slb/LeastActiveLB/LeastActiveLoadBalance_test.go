@@ -5,6 +5,7 @@ import (
 	"EH-Proxy/pkg/system/sysPrint"
 	"log"
 	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -148,3 +149,95 @@ func TestDeleteServerNode(t *testing.T) {
 		t.Errorf("expect no server error,but error is nil")
 	}
 }
+
+func TestSelectNodeWeightRatio(t *testing.T) {
+	for _, lb := range []*LALB{CreateLALB(), CreateWeightedLALB()} {
+		light, err := server.NewServer("127.0.0.1:20001", 10, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		heavy, err := server.NewServer("127.0.0.1:20002", 100, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = lb.InitServerNode([]*server.Server{light, heavy})
+		if err != nil {
+			t.Error(err)
+		}
+
+		// 活跃请求数/权重：light 为 5/10，heavy 为 20/100，应选择 heavy
+		for i := 0; i < 5; i++ {
+			light.IncrActiveReq()
+		}
+		for i := 0; i < 20; i++ {
+			heavy.IncrActiveReq()
+		}
+		for i := 0; i < 1000; i++ {
+			s, err := lb.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s != heavy {
+				t.Fatalf("expect server %s, actual %s", heavy.Addr(), s.Addr())
+			}
+		}
+
+		// 空闲时请求按权重比例分配
+		for i := 0; i < 5; i++ {
+			light.DecrActiveReq()
+		}
+		for i := 0; i < 20; i++ {
+			heavy.DecrActiveReq()
+		}
+		cnt := make(map[*server.Server]int, 0)
+		for i := 0; i < SelectNodeTestCount; i++ {
+			s, err := lb.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			cnt[s]++
+		}
+		actual := float64(cnt[light]) / SelectNodeTestCount
+		if actual < 0.08 || actual > 0.10 {
+			t.Errorf("server %s weight:%d, expect:%.3f, actual:%.3f", light.Addr(), light.Weight(), 10.0/110, actual)
+		}
+
+		// 全部节点主观下线
+		light.SetPfail(server.IS_PFAIL)
+		heavy.SetPfail(server.IS_PFAIL)
+		_, err = lb.SelectNode()
+		if err != sysPrint.ErrNoServer {
+			t.Errorf("expect no server error, actual:%v", err)
+		}
+	}
+}
+
+func TestConcurrentAddDelete(t *testing.T) {
+	lb := CreateWeightedLALB()
+	err := lb.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for k := 0; k < DeleteNodeTestCount; k++ {
+			s := testServerList[rand.Intn(serverCount-1)+1]
+			if lb.DeleteServerNode(s) == nil {
+				_ = lb.AddServerNode(s)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for k := 0; k < DeleteNodeTestCount; k++ {
+			_, err := lb.SelectNode()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,226 @@
+// Google Maglev Hashing Load Balance
+
+package MaglevLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"crypto/md5"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	DEFAULT_TABLE_SIZE = 65537 // 默认查找表大小，必须为质数且远大于服务器数目
+	MIN_TABLE_SIZE     = 3     // 查找表大小下限
+)
+
+// MGLB Maglev Load Balancer
+type MGLB struct {
+	table     []*server.Server            // 查找表
+	serverMap map[*server.Server]struct{} // 服务器集合
+	rwLock    sync.RWMutex                // 读写锁
+	tableSize uint64                      // 查找表大小
+}
+
+// CreateMGLB 创建一个 Maglev Load Balancer
+func CreateMGLB() *MGLB {
+	return CreateMGLBWithTableSize(DEFAULT_TABLE_SIZE)
+}
+
+// CreateMGLBWithTableSize 创建一个 Maglev Load Balancer，并指定查找表大小
+// tableSize 不是质数时使用大于它的最小质数
+func CreateMGLBWithTableSize(tableSize int) *MGLB {
+	if tableSize < MIN_TABLE_SIZE {
+		tableSize = MIN_TABLE_SIZE
+	}
+	return &MGLB{
+		table:     make([]*server.Server, 0),
+		serverMap: make(map[*server.Server]struct{}, 0),
+		rwLock:    sync.RWMutex{},
+		tableSize: nextPrime(uint64(tableSize)),
+	}
+}
+
+// nextPrime 返回不小于 n 的最小质数
+func nextPrime(n uint64) uint64 {
+	for ; ; n++ {
+		isPrime := n >= 2
+		for i := uint64(2); i*i <= n; i++ {
+			if n%i == 0 {
+				isPrime = false
+				break
+			}
+		}
+		if isPrime {
+			return n
+		}
+	}
+}
+
+// hashKey 计算 key 的哈希值
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// permutation 服务器在查找表中的偏好序列，第 j 个偏好位置为 (offset + j * skip) % tableSize
+type permutation struct {
+	server *server.Server
+	offset uint64
+	skip   uint64
+	next   uint64  // 下一个待尝试的偏好序号
+	credit float64 // 累计的填表机会，用于按权重填表
+	step   float64 // 每轮获得的填表机会：权重 / 最大权重
+}
+
+// populate 重建查找表，调用方需持有写锁
+// 按地址排序后轮流让各服务器沿自己的偏好序列占据第一个空位，权重越高的服务器每轮获得的占位机会越多，
+// 由于偏好序列只与服务器地址有关，服务器变更时大部分表项保持不变
+func (lb *MGLB) populate() {
+	if len(lb.serverMap) == 0 {
+		lb.table = make([]*server.Server, 0)
+		return
+	}
+
+	servers := make([]*server.Server, 0, len(lb.serverMap))
+	var maxWeight int32
+	for s := range lb.serverMap {
+		servers = append(servers, s)
+		if s.Weight() > maxWeight {
+			maxWeight = s.Weight()
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Addr() < servers[j].Addr()
+	})
+
+	perms := make([]*permutation, 0, len(servers))
+	for _, s := range servers {
+		digest := md5.Sum([]byte(s.Addr()))
+		perms = append(perms, &permutation{
+			server: s,
+			offset: binary.LittleEndian.Uint64(digest[0:8]) % lb.tableSize,
+			skip:   binary.LittleEndian.Uint64(digest[8:16])%(lb.tableSize-1) + 1,
+			step:   float64(s.Weight()) / float64(maxWeight),
+		})
+	}
+
+	table := make([]*server.Server, lb.tableSize)
+	var filled uint64
+	for filled < lb.tableSize {
+		for _, p := range perms {
+			p.credit += p.step
+			for p.credit >= 1 && filled < lb.tableSize {
+				p.credit--
+				idx := (p.offset + p.next*p.skip) % lb.tableSize
+				for table[idx] != nil {
+					p.next++
+					idx = (p.offset + p.next*p.skip) % lb.tableSize
+				}
+				table[idx] = p.server
+				p.next++
+				filled++
+			}
+		}
+	}
+	lb.table = table
+}
+
+// Reset 重置负载均衡器
+func (lb *MGLB) Reset() {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.table = make([]*server.Server, 0)
+	lb.serverMap = make(map[*server.Server]struct{}, 0)
+}
+
+// AddServerNode 向负载均衡器添加一个服务器节点，并重建查找表
+func (lb *MGLB) AddServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	lb.serverMap[serverNode] = struct{}{}
+	lb.populate()
+	return nil
+}
+
+// DeleteServerNode 从负载均衡器中删除一个服务器节点，并重建查找表
+func (lb *MGLB) DeleteServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	delete(lb.serverMap, serverNode)
+	lb.populate()
+	return nil
+}
+
+// OnServerUpdate 服务器权重变更后重建查找表
+// 主观下线与排空状态在选择时实时检查，不重建查找表，以保持其他服务器的映射不变
+func (lb *MGLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	if change != server.WeightChanged {
+		return
+	}
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		lb.populate()
+	}
+}
+
+// InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化
+// 所有节点加入后只重建一次查找表
+func (lb *MGLB) InitServerNode(serverNodeList []*server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.serverMap = make(map[*server.Server]struct{}, len(serverNodeList))
+	for _, s := range serverNodeList {
+		if _, ok := lb.serverMap[s]; ok {
+			lb.populate()
+			return sysPrint.ErrServerExists
+		}
+		lb.serverMap[s] = struct{}{}
+	}
+	lb.populate()
+	return nil
+}
+
+// SelectNode 随机选取查找表中的一个表项
+// 请求没有可用的哈希键时使用，正常情况下应使用 SelectNodeByKey
+func (lb *MGLB) SelectNode() (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	return lb.lookup(rand.Uint64())
+}
+
+// SelectNodeByKey 根据 key 查找查找表选取一个服务器节点，时间复杂度 O(1)
+// 若该表项的服务器被主观认为下线或排空，则依次尝试下一个表项
+func (lb *MGLB) SelectNodeByKey(key string) (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	return lb.lookup(hashKey(key))
+}
+
+// lookup 查找 hash 对应表项及其之后第一个可用的服务器节点，调用方需持有读锁
+func (lb *MGLB) lookup(hash uint64) (*server.Server, error) {
+	n := uint64(len(lb.table))
+	if n == 0 {
+		return nil, sysPrint.ErrNoServer
+	}
+	idx := hash % n
+	for i := uint64(0); i < n; i++ {
+		s := lb.table[(idx+i)%n]
+		if s.Available() {
+			return s, nil
+		}
+	}
+	return nil, sysPrint.ErrNoServer
+}
@@ -0,0 +1,53 @@
+package MaglevLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"log"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+const (
+	serverNum = 1000
+	testHost  = "127.0.0.1"
+	maxWeight = 400
+)
+
+var (
+	testServerPort = 10001
+)
+
+func BenchmarkSelectNodeByKey(b *testing.B) {
+	loadBalancer = CreateMGLB()
+	servers := make([]*server.Server, 0, serverNum)
+	for i := 0; i < serverNum; i++ {
+		addr := testHost + ":" + strconv.Itoa(testServerPort)
+		testServerPort++
+		s, err := server.NewServer(addr, int32(rand.Intn(maxWeight)+1), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+
+	// 一次性初始化，避免逐个添加时重复重建查找表
+	err := loadBalancer.InitServerNode(servers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "user-" + strconv.Itoa(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := loadBalancer.SelectNodeByKey(keys[i&1023])
+		if err != nil {
+			b.Error(err)
+		}
+	}
+
+}
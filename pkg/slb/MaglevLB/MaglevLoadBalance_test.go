@@ -0,0 +1,197 @@
+package MaglevLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"log"
+	"math"
+	"strconv"
+	"testing"
+)
+
+const (
+	AllowableErrorRange = 0.01
+	AllowableDisruption = 0.05
+	KeyTestCount        = 100000
+	SelectNodeTestCount = 100000
+)
+
+var (
+	testServerMap  = map[string]int32{"127.0.0.1:10001": 1, "127.0.0.1:10002": 4, "127.0.0.1:10003": 2, "127.0.0.1:10004": 3, "127.0.0.1:10005": 5}
+	testServerList = make([]*server.Server, 0)
+	serverCount    = len(testServerMap)
+	loadBalancer   *MGLB
+)
+
+func init() {
+	loadBalancer = CreateMGLB()
+}
+
+// selectAll 将 KeyTestCount 个 key 映射到服务器
+func selectAll(t *testing.T) map[string]*server.Server {
+	res := make(map[string]*server.Server, KeyTestCount)
+	for i := 0; i < KeyTestCount; i++ {
+		key := "user-" + strconv.Itoa(i)
+		s, err := loadBalancer.SelectNodeByKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[key] = s
+	}
+	return res
+}
+
+// checkTableShare 检查各服务器占据的表项比例是否与权重比例相近
+func checkTableShare(t *testing.T) {
+	var weightSum int32
+	for s := range loadBalancer.serverMap {
+		weightSum += s.Weight()
+	}
+	cnt := make(map[*server.Server]int, 0)
+	for _, s := range loadBalancer.table {
+		if s == nil {
+			t.Fatal("lookup table has empty entry")
+		}
+		cnt[s]++
+	}
+	for s := range loadBalancer.serverMap {
+		expect := float64(s.Weight()) / float64(weightSum)
+		actual := float64(cnt[s]) / float64(len(loadBalancer.table))
+		if math.Abs(actual-expect) > AllowableErrorRange {
+			t.Errorf("server %s weight:%d, expect:%.3f, actual:%.3f", s.Addr(), s.Weight(), expect, actual)
+		}
+	}
+}
+
+func TestAddServerNode(t *testing.T) {
+	for addr, weight := range testServerMap {
+		s, err := server.NewServer(addr, weight, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testServerList = append(testServerList, s)
+	}
+	if uint64(len(loadBalancer.table)) != loadBalancer.tableSize {
+		t.Errorf("unexpected table size, expect %d, actual %d", loadBalancer.tableSize, len(loadBalancer.table))
+	}
+	checkTableShare(t)
+
+	err := loadBalancer.AddServerNode(testServerList[0])
+	if err == nil {
+		t.Error("Adding the same node repeatedly should fail.")
+	}
+
+	// test InitServerNode
+	before := append([]*server.Server{}, loadBalancer.table...)
+	err = loadBalancer.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	for i := range before {
+		if before[i] != loadBalancer.table[i] {
+			t.Fatalf("lookup table changed after InitServerNode at index %d", i)
+		}
+	}
+}
+
+func TestSelectNodeByKey(t *testing.T) {
+	first := selectAll(t)
+	for key, s := range selectAll(t) {
+		if first[key] != s {
+			t.Fatalf("key %s mapped to different servers: %s, %s", key, first[key].Addr(), s.Addr())
+		}
+	}
+
+	// 主观下线的服务器不应被选中，其他 key 的映射不受影响
+	failServer := testServerList[0]
+	failServer.SetPfail(server.IS_PFAIL)
+	for key, s := range selectAll(t) {
+		if s == failServer {
+			t.Fatalf("Selected server that is considered subjective fail. addr:%s", s.Addr())
+		}
+		if first[key] != failServer && first[key] != s {
+			t.Fatalf("key %s remapped from %s to %s", key, first[key].Addr(), s.Addr())
+		}
+	}
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := loadBalancer.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		if s == failServer {
+			t.Fatalf("Selected server that is considered subjective fail. addr:%s", s.Addr())
+		}
+	}
+	failServer.SetPfail(server.NOT_PFAIL)
+}
+
+func TestOnServerUpdate(t *testing.T) {
+	s := testServerList[0]
+	weight := s.Weight()
+	err := s.SetWeight(weight * 10)
+	if err != nil {
+		t.Error(err)
+	}
+	loadBalancer.OnServerUpdate(s, server.WeightChanged)
+	checkTableShare(t)
+
+	err = s.SetWeight(weight)
+	if err != nil {
+		t.Error(err)
+	}
+	loadBalancer.OnServerUpdate(s, server.WeightChanged)
+	checkTableShare(t)
+}
+
+func TestDeleteServerNode(t *testing.T) {
+	before := selectAll(t)
+	delServer := testServerList[len(testServerList)-1]
+	err := loadBalancer.DeleteServerNode(delServer)
+	if err != nil {
+		t.Error(err)
+	}
+	checkTableShare(t)
+
+	// 删除服务器后，原本不属于该服务器的 key 只有极少部分会被重新映射
+	disrupted := 0
+	kept := 0
+	for key, s := range selectAll(t) {
+		if s == delServer {
+			t.Fatalf("Selected server that is deleted. addr:%s", s.Addr())
+		}
+		if before[key] != delServer {
+			kept++
+			if before[key] != s {
+				disrupted++
+			}
+		}
+	}
+	if rate := float64(disrupted) / float64(kept); rate > AllowableDisruption {
+		t.Errorf("too many keys remapped after deleting a server, rate:%.3f", rate)
+	}
+
+	err = loadBalancer.AddServerNode(delServer)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 删除所有节点
+	for i := 0; i < serverCount; i++ {
+		err = loadBalancer.DeleteServerNode(testServerList[i])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	_, err = loadBalancer.SelectNodeByKey("user-0")
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+	_, err = loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+}
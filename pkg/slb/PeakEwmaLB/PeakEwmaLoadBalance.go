@@ -0,0 +1,122 @@
+// Power of 2 choices + Peak EWMA Load Balance
+
+package PeakEwmaLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/slb/internal/sample"
+	"EH-Proxy/pkg/system/sysPrint"
+	"sync"
+)
+
+const (
+	DEFAULT_MAXRETRY = 3    // 随机采样遇到不可用节点时的最大重试次数
+	PENALTY          = 1e18 // 尚无延迟样本却已有活跃请求的节点的代价
+)
+
+// PELB Peak EWMA Load Balancer
+type PELB struct {
+	serverList []*server.Server       // 服务器列表
+	serverMap  map[*server.Server]int // Key-value: server-serverList索引 哈希表
+	rwLock     sync.RWMutex           // 读写锁
+	maxRetry   int                    // 随机采样的最大重试次数
+}
+
+// CreatePELB 创建一个 Peak EWMA Load Balancer
+func CreatePELB() *PELB {
+	return &PELB{
+		serverList: make([]*server.Server, 0),
+		serverMap:  make(map[*server.Server]int, 0),
+		rwLock:     sync.RWMutex{},
+		maxRetry:   DEFAULT_MAXRETRY,
+	}
+}
+
+// Reset 重置负载均衡器
+func (lb *PELB) Reset() {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.serverList = make([]*server.Server, 0)
+	lb.serverMap = make(map[*server.Server]int, 0)
+}
+
+// AddServerNode 向负载均衡器添加一个服务器节点
+func (lb *PELB) AddServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	lb.serverList = append(lb.serverList, serverNode)
+	lb.serverMap[serverNode] = len(lb.serverList) - 1
+	return nil
+}
+
+// DeleteServerNode 从负载均衡器中删除一个服务器节点
+// 将最后一个节点移动到被删除节点的位置，时间复杂度 O(1)
+func (lb *PELB) DeleteServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	idx, ok := lb.serverMap[serverNode]
+	if !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	delete(lb.serverMap, serverNode)
+
+	last := len(lb.serverList) - 1
+	if idx != last {
+		lb.serverList[idx] = lb.serverList[last]
+		lb.serverMap[lb.serverList[idx]] = idx
+	}
+	lb.serverList[last] = nil
+	lb.serverList = lb.serverList[:last]
+	return nil
+}
+
+// InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化
+func (lb *PELB) InitServerNode(serverNodeList []*server.Server) error {
+	lb.Reset()
+	for _, s := range serverNodeList {
+		err := lb.AddServerNode(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnServerUpdate 选择时实时读取服务器的活跃请求数、响应延迟与可用状态，无需更新内部数据结构
+func (lb *PELB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+}
+
+// cost 计算服务器节点的代价：响应延迟 Peak EWMA * (活跃请求数 + 1)
+// 新加入的节点没有延迟样本，在没有活跃请求时代价为 0 以便尽快获得样本，有活跃请求时则给予惩罚值
+func cost(s *server.Server) float64 {
+	latency := float64(s.LatencyEWMA())
+	active := float64(s.ActiveReq())
+	if latency == 0 && active != 0 {
+		return PENALTY + active
+	}
+	return latency * (active + 1)
+}
+
+// SelectNode 选取一个服务器节点
+// 每次随机选取两个可用节点，选择 响应延迟 Peak EWMA * (活跃请求数 + 1) 更小的一方，
+// 使硬件较差、响应较慢的节点获得更少的请求
+func (lb *PELB) SelectNode() (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	if len(lb.serverList) == 0 {
+		return nil, sysPrint.ErrNoServer
+	}
+
+	first := sample.RandomAvailable(lb.serverList, nil, lb.maxRetry)
+	if first == nil {
+		return nil, sysPrint.ErrNoServer
+	}
+	second := sample.RandomAvailable(lb.serverList, first, lb.maxRetry)
+	if second == nil || cost(first) <= cost(second) {
+		return first, nil
+	}
+	return second, nil
+}
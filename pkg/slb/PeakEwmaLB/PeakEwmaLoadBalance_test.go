@@ -0,0 +1,202 @@
+package PeakEwmaLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"log"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const (
+	SelectNodeTestCount = 100000
+	DeleteNodeTestCount = 100000
+)
+
+var (
+	testServerMap  = map[string]int32{"127.0.0.1:10001": 1, "127.0.0.1:10002": 4, "127.0.0.1:10003": 2, "127.0.0.1:10004": 3, "127.0.0.1:10005": 5}
+	testServerList = make([]*server.Server, 0)
+	serverCount    = len(testServerMap)
+	loadBalancer   *PELB
+)
+
+func init() {
+	loadBalancer = CreatePELB()
+}
+
+func TestAddServerNode(t *testing.T) {
+	for addr, weight := range testServerMap {
+		s, err := server.NewServer(addr, weight, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testServerList = append(testServerList, s)
+	}
+
+	for i, s := range loadBalancer.serverList {
+		if loadBalancer.serverMap[s] != i {
+			t.Errorf("unexpected server index, server address:%s, expect %d, actual %d", s.Addr(), i, loadBalancer.serverMap[s])
+		}
+	}
+
+	err := loadBalancer.AddServerNode(testServerList[0])
+	if err == nil {
+		t.Error("Adding the same node repeatedly should fail.")
+	}
+
+	// test InitServerNode
+	err = loadBalancer.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(loadBalancer.serverList) != serverCount {
+		t.Errorf("unexpected server count, expect %d, actual %d", serverCount, len(loadBalancer.serverList))
+	}
+}
+
+func TestSelectNode(t *testing.T) {
+	for _, failServer := range testServerList {
+		failServer.SetPfail(server.IS_PFAIL)
+		m := make(map[*server.Server]struct{}, 0)
+		for i := 0; i < SelectNodeTestCount; i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() == failServer.Addr() {
+				t.Errorf("Selected server that is considered subjective fail. addr:%s", s.Addr())
+			}
+			m[s] = struct{}{}
+		}
+		for _, s := range testServerList {
+			if failServer == s {
+				continue
+			}
+			if _, ok := m[s]; !ok {
+				t.Errorf("node %s not selected", s.Addr())
+			}
+		}
+		failServer.SetPfail(server.NOT_PFAIL)
+	}
+}
+
+func TestSelectNodeLatency(t *testing.T) {
+	// 慢节点的延迟为其他节点的 100 倍，应当很少被选中
+	slowServer := testServerList[0]
+	for _, s := range testServerList {
+		if s == slowServer {
+			s.RecordLatency(100 * time.Millisecond)
+		} else {
+			s.RecordLatency(time.Millisecond)
+		}
+	}
+
+	cnt := make(map[*server.Server]int, 0)
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := loadBalancer.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		cnt[s]++
+	}
+	for _, s := range testServerList {
+		if s != slowServer && cnt[s] <= cnt[slowServer] {
+			t.Errorf("slow server %s selected %d times, more than server %s selected %d times",
+				slowServer.Addr(), cnt[slowServer], s.Addr(), cnt[s])
+		}
+	}
+
+	// 活跃请求数同样计入代价
+	for i := 0; i < 1000; i++ {
+		testServerList[1].IncrActiveReq()
+	}
+	cnt = make(map[*server.Server]int, 0)
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := loadBalancer.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		cnt[s]++
+	}
+	for _, s := range testServerList {
+		if s != testServerList[1] && cnt[s] <= cnt[testServerList[1]] {
+			t.Errorf("busy server %s selected %d times, more than server %s selected %d times",
+				testServerList[1].Addr(), cnt[testServerList[1]], s.Addr(), cnt[s])
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		testServerList[1].DecrActiveReq()
+	}
+}
+
+func TestSelectNodeFailure(t *testing.T) {
+	// 快速失败的节点以 FailureLatency 作为延迟样本，应当很少被选中
+	failServer := testServerList[0]
+	for _, s := range testServerList {
+		s.IncrActiveReq()
+		if s == failServer {
+			s.ReleaseResult(time.Microsecond, true, true)
+		} else {
+			s.ReleaseResult(10*time.Millisecond, false, false)
+		}
+	}
+	if failServer.LatencyEWMA() < server.FailureLatency/2 {
+		t.Errorf("failed request should be recorded as penalty latency, actual:%s", failServer.LatencyEWMA())
+	}
+
+	cnt := make(map[*server.Server]int, 0)
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := loadBalancer.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		cnt[s]++
+	}
+	for _, s := range testServerList {
+		if s != failServer && cnt[s] <= cnt[failServer] {
+			t.Errorf("failing server %s selected %d times, more than server %s selected %d times",
+				failServer.Addr(), cnt[failServer], s.Addr(), cnt[s])
+		}
+	}
+}
+
+func TestDeleteServerNode(t *testing.T) {
+	for k := 0; k < DeleteNodeTestCount; k++ {
+		DelIdx := rand.Intn(serverCount)
+		err := loadBalancer.DeleteServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+		for i := 0; i < serverCount; i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() == testServerList[DelIdx].Addr() {
+				t.Errorf("Selected server that is deleted. addr:%s", s.Addr())
+			}
+		}
+		err = loadBalancer.AddServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// 删除所有节点
+	for i := 0; i < serverCount; i++ {
+		err := loadBalancer.DeleteServerNode(testServerList[i])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err := loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+}
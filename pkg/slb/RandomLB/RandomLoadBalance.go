@@ -25,12 +25,20 @@ type RDLB struct {
 
 // CreateRDLB 创建一个 Random Load Balancer
 func CreateRDLB() *RDLB {
+	return CreateRDLBWithMaxRetry(DEFAULT_MAXRETRY)
+}
+
+// CreateRDLBWithMaxRetry 创建一个 Random Load Balancer，并指定选中不可用节点时的最大重试次数
+func CreateRDLBWithMaxRetry(maxRetry int) *RDLB {
+	if maxRetry < 0 {
+		maxRetry = DEFAULT_MAXRETRY
+	}
 	return &RDLB{
 		weightSum:     make([]int64, 0),
 		serverList:    make([]*server.Server, 0),
 		delWeightSum:  0,
 		rwLock:        sync.RWMutex{},
-		maxRetry:      DEFAULT_MAXRETRY,
+		maxRetry:      maxRetry,
 		serverMap:     make(map[*server.Server]int, 0),
 		serverMapLock: sync.Mutex{},
 	}
@@ -58,20 +66,25 @@ func (lb *RDLB) AddServerNode(serverNode *server.Server) error {
 
 	lb.rwLock.Lock()
 	defer lb.rwLock.Unlock()
-	if serverNode.Weight() < 1 {
-		serverNode.SetWeight(1)
-	}
 	lb.serverList = append(lb.serverList, serverNode)
 	lb.serverMap[serverNode] = len(lb.serverList) - 1
 
 	if len(lb.weightSum) == 0 {
-		lb.weightSum = append(lb.weightSum, int64(serverNode.Weight()))
+		lb.weightSum = append(lb.weightSum, nodeWeight(serverNode))
 	} else {
-		lb.weightSum = append(lb.weightSum, int64(serverNode.Weight())+lb.weightSum[len(lb.weightSum)-1])
+		lb.weightSum = append(lb.weightSum, nodeWeight(serverNode)+lb.weightSum[len(lb.weightSum)-1])
 	}
 	return nil
 }
 
+// nodeWeight 服务器节点在权重前缀和中的权重，被主观认为下线或排空的节点权重为 0，不会被随机选中
+func nodeWeight(serverNode *server.Server) int64 {
+	if !serverNode.Available() {
+		return 0
+	}
+	return int64(serverNode.Weight())
+}
+
 // DeleteServerNode 从负载均衡器中删除一个服务器节点
 func (lb *RDLB) DeleteServerNode(serverNode *server.Server) error {
 	lb.serverMapLock.Lock()
@@ -84,32 +97,55 @@ func (lb *RDLB) DeleteServerNode(serverNode *server.Server) error {
 
 	lb.rwLock.Lock()
 	defer lb.rwLock.Unlock()
-	lb.serverList[idx] = nil                      // 将服务器节点设为 nil
-	lb.delWeightSum += int64(serverNode.Weight()) // 累加已删除节点权值
+	lb.serverList[idx] = nil // 将服务器节点设为 nil
+
+	// 累加已删除节点在前缀和中的权值
+	lb.delWeightSum += lb.weightSum[idx]
+	if idx > 0 {
+		lb.delWeightSum -= lb.weightSum[idx-1]
+	}
 
 	// 懒惰删除：比较删除节点权值是否大于阈值，若超过阈值则重构负载均衡器
 	if float64(lb.delWeightSum)/float64(lb.weightSum[len(lb.weightSum)-1]) > LAZYDEL_THRESHOLD {
-		// 重构前缀和与 serverList
-		tempServerList := make([]*server.Server, 0)
-		tempWeightSum := make([]int64, 0)
-		for key, _ := range lb.serverMap {
-			delete(lb.serverMap, key)
-		}
-		for i := 0; i < len(lb.serverList); i++ {
-			if lb.serverList[i] != nil {
-				tempServerList = append(tempServerList, lb.serverList[i])
-				lb.serverMap[lb.serverList[i]] = len(tempServerList) - 1
-				if len(tempWeightSum) == 0 {
-					tempWeightSum = append(tempWeightSum, int64(lb.serverList[i].Weight()))
-				} else {
-					tempWeightSum = append(tempWeightSum, int64(lb.serverList[i].Weight())+tempWeightSum[len(tempWeightSum)-1])
-				}
+		lb.rebuild()
+	}
+	return nil
+}
+
+// rebuild 重构前缀和与 serverList，移除已删除的节点并按服务器当前的权重与状态重新计算前缀和
+// 调用方需持有 serverMapLock 与写锁
+func (lb *RDLB) rebuild() {
+	tempServerList := make([]*server.Server, 0, len(lb.serverMap))
+	tempWeightSum := make([]int64, 0, len(lb.serverMap))
+	for key := range lb.serverMap {
+		delete(lb.serverMap, key)
+	}
+	for i := 0; i < len(lb.serverList); i++ {
+		if lb.serverList[i] != nil {
+			tempServerList = append(tempServerList, lb.serverList[i])
+			lb.serverMap[lb.serverList[i]] = len(tempServerList) - 1
+			if len(tempWeightSum) == 0 {
+				tempWeightSum = append(tempWeightSum, nodeWeight(lb.serverList[i]))
+			} else {
+				tempWeightSum = append(tempWeightSum, nodeWeight(lb.serverList[i])+tempWeightSum[len(tempWeightSum)-1])
 			}
 		}
-		lb.serverList = tempServerList
-		lb.weightSum = tempWeightSum
 	}
-	return nil
+	lb.serverList = tempServerList
+	lb.weightSum = tempWeightSum
+	lb.delWeightSum = 0
+}
+
+// OnServerUpdate 服务器权重或可用状态变更后重构前缀和，使新权重立即生效，并使不可用的节点不再被随机选中
+func (lb *RDLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	lb.serverMapLock.Lock()
+	defer lb.serverMapLock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; !ok {
+		return
+	}
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.rebuild()
 }
 
 // InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化
@@ -135,6 +171,9 @@ func (lb *RDLB) SelectNode() (*server.Server, error) {
 
 	for i := 0; i <= lb.maxRetry; i++ {
 		n := lb.weightSum[len(lb.weightSum)-1]
+		if n == 0 {
+			break // 所有节点均不可用或已删除
+		}
 		target := rand.Int63n(n) + 1 // 在 1 ~ 权重总和 范围内随机取值
 
 		// 使用二分查找在权重前缀和切片中查找节点对应 index
@@ -151,18 +190,25 @@ func (lb *RDLB) SelectNode() (*server.Server, error) {
 		if serverNode == nil {
 			continue
 		}
-		if serverNode.Pfail() == server.NOT_PFAIL {
-			return serverNode, nil
+		if !serverNode.Available() {
+			continue
+		}
+
+		// 处于慢启动阶段的节点以 有效权重/权重 的概率接受选择，使其被选中的概率与有效权重成正比
+		if weight, effective := serverNode.Weight(), serverNode.EffectiveWeight(); effective < weight &&
+			rand.Int31n(weight) >= effective {
+			continue
 		}
+		return serverNode, nil
 	}
 
 	// 达到最大重试次数未能成功获取可用节点，降级成随机起点轮询
 	idx := rand.Intn(len(lb.serverList))
-	if lb.serverList[idx] != nil && lb.serverList[idx].Pfail() == server.NOT_PFAIL {
+	if lb.serverList[idx] != nil && lb.serverList[idx].Available() {
 		return lb.serverList[idx], nil
 	}
 	for i := (idx + 1) % len(lb.serverList); i != idx; i = (i + 1) % len(lb.serverList) {
-		if lb.serverList[i] != nil && lb.serverList[i].Pfail() == server.NOT_PFAIL {
+		if lb.serverList[i] != nil && lb.serverList[i].Available() {
 			return lb.serverList[i], nil
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math/rand"
 	"testing"
+	"time"
 )
 
 const (
@@ -166,3 +167,103 @@ func TestDeleteServerNode(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestSelectNodeSlowStart(t *testing.T) {
+	lb := CreateRDLB()
+	warm, err := server.NewServer("127.0.0.1:20001", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold, err := server.NewServer("127.0.0.1:20002", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold.SetSlowStart(time.Hour)
+	cold.StartSlowStart()
+	err = lb.InitServerNode([]*server.Server{warm, cold})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 慢启动节点被选中的概率应与有效权重成正比
+	cnt := 0
+	for i := 0; i < SelectNodeTestCount; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		if s == cold {
+			cnt++
+		}
+	}
+	effective := float64(cold.EffectiveWeight())
+	expect := effective / (effective + float64(warm.Weight()))
+	actual := float64(cnt) / SelectNodeTestCount
+	if actual > expect+0.02 || actual < expect-0.02 {
+		t.Errorf("server in slow start, expect:%.3f, actual:%.3f", expect, actual)
+	}
+}
+
+func TestOnServerUpdate(t *testing.T) {
+	lb := CreateRDLB()
+	a, err := server.NewServer("127.0.0.1:20001", 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := server.NewServer("127.0.0.1:20002", 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*server.Server{a, b} {
+		err = lb.AddServerNode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 权重变更后立即重构前缀和
+	err = a.SetWeight(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.OnServerUpdate(a, server.WeightChanged)
+	if total := lb.weightSum[len(lb.weightSum)-1]; total != 400 {
+		t.Errorf("expect weight sum:%d, actual:%d", 400, total)
+	}
+
+	// 主观下线的节点在前缀和中的权重为 0，不会被随机选中
+	b.SetPfail(server.IS_PFAIL)
+	lb.OnServerUpdate(b, server.PfailChanged)
+	if total := lb.weightSum[len(lb.weightSum)-1]; total != 300 {
+		t.Errorf("expect weight sum:%d, actual:%d", 300, total)
+	}
+	for i := 0; i < 1000; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != a {
+			t.Fatalf("selected pfail server:%s", s.Addr())
+		}
+	}
+
+	// 所有节点均不可用
+	a.SetDrain(true)
+	lb.OnServerUpdate(a, server.DrainChanged)
+	_, err = lb.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Errorf("expect error:%v, actual:%v", sysPrint.ErrNoServer, err)
+	}
+
+	// 删除节点后已删除权重和按前缀和计算
+	a.SetDrain(false)
+	b.SetPfail(server.NOT_PFAIL)
+	lb.OnServerUpdate(b, server.PfailChanged)
+	err = lb.DeleteServerNode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := lb.weightSum[len(lb.weightSum)-1]; total != 300 {
+		t.Errorf("expect weight sum:%d, actual:%d", 300, total)
+	}
+}
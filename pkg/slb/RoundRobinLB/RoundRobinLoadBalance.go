@@ -9,7 +9,8 @@ import (
 
 type node struct {
 	server *server.Server
-	weight int32
+	weight int32 // 本轮剩余可选次数
+	quota  int32 // 本轮分配的可选次数（放入 backupList 时的有效权重）
 	next   *node
 }
 
@@ -25,6 +26,7 @@ type RRLB struct {
 	backupListLock  sync.Mutex
 	serverSet       map[*server.Server]struct{}
 	serverSetLock   sync.Mutex
+	nodeNum         int // 节点数目，由 currentListLock 保护
 }
 
 // CreateRRLB 创建一个 Round Robin Load Balancer
@@ -57,7 +59,8 @@ func CreateRRLB() *RRLB {
 func (ls *list) HeadInsert(insertNode *node) {
 	insertNode.next = ls.head.next
 	ls.head.next = insertNode
-	insertNode.weight = insertNode.server.Weight()
+	insertNode.weight = insertNode.server.EffectiveWeight()
+	insertNode.quota = insertNode.weight
 }
 
 func (lb *RRLB) backupHeadInsert(insertNode *node) {
@@ -105,6 +108,7 @@ func (lb *RRLB) Reset() {
 	}
 	lb.prevNode = lb.currentList.head
 	lb.serverSet = make(map[*server.Server]struct{}, 0)
+	lb.nodeNum = 0
 }
 
 // AddServerNode 添加服务器节点
@@ -120,16 +124,15 @@ func (lb *RRLB) AddServerNode(serverNode *server.Server) error {
 	lb.currentListLock.Lock()
 	defer lb.currentListLock.Unlock()
 
-	// 权重最低设置为 1
-	if serverNode.Weight() < 1 {
-		serverNode.SetWeight(1)
-	}
+	weight := serverNode.EffectiveWeight()
 	n := &node{
 		server: serverNode,
-		weight: serverNode.Weight(),
+		weight: weight,
+		quota:  weight,
 		next:   lb.currentList.head.next,
 	}
 	lb.currentList.head.next = n
+	lb.nodeNum++
 	return nil
 }
 
@@ -148,10 +151,12 @@ func (lb *RRLB) DeleteServerNode(serverNode *server.Server) error {
 	}
 
 	if lb.currentList.searchAndDelete(serverNode) {
+		lb.nodeNum--
 		return nil
 	}
 
 	if lb.backupList.searchAndDelete(serverNode) {
+		lb.nodeNum--
 		return nil
 	}
 
@@ -172,6 +177,54 @@ func (lb *RRLB) InitServerNode(serverNodeList []*server.Server) error {
 	return nil
 }
 
+// OnServerUpdate 服务器状态变更时立即更新对应节点
+// 权重变更：backupList 中的节点直接使用新的有效权重，currentList 中的节点按新旧权重之差调整本轮剩余次数，
+// 剩余次数不大于 0 时移入 backupList；
+// 主观下线或排空：currentList 中的节点立即移入 backupList；
+// 恢复可用：backupList 中的节点立即移回 currentList，插入到下一个被选择的位置
+func (lb *RRLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	lb.currentListLock.Lock()
+	defer lb.currentListLock.Unlock()
+	lb.backupListLock.Lock()
+	defer lb.backupListLock.Unlock()
+
+	available := serverNode.Available()
+	pred := lb.currentList.head
+	for cur := pred.next; cur != nil; pred, cur = cur, cur.next {
+		if cur.server != serverNode {
+			continue
+		}
+		if change == server.WeightChanged {
+			weight := serverNode.EffectiveWeight()
+			cur.weight += weight - cur.quota
+			cur.quota = weight
+		}
+		if cur.weight <= 0 || !available {
+			pred.next = cur.next
+			if lb.prevNode == cur {
+				lb.prevNode = pred
+			}
+			lb.backupList.HeadInsert(cur)
+		}
+		return
+	}
+
+	pred = lb.backupList.head
+	for cur := pred.next; cur != nil; pred, cur = cur, cur.next {
+		if cur.server != serverNode {
+			continue
+		}
+		cur.weight = serverNode.EffectiveWeight()
+		cur.quota = cur.weight
+		if available && change != server.WeightChanged {
+			pred.next = cur.next
+			cur.next = lb.prevNode.next
+			lb.prevNode.next = cur
+		}
+		return
+	}
+}
+
 // SelectNode 通过 RoundRobin 算法选择一个服务器节点
 // 使用双链表进行优化，时间复杂度 O(1)
 func (lb *RRLB) SelectNode() (*server.Server, error) {
@@ -211,8 +264,14 @@ func (lb *RRLB) SelectNode() (*server.Server, error) {
 		return nil, err
 	}
 
-	// 当前节点被主观认为下线，直接加入 backup 链表，跳过当前节点
-	for cur.server.Pfail() == server.IS_PFAIL {
+	// 当前节点被主观认为下线或排空，直接加入 backup 链表，跳过当前节点
+	// 所有节点均被跳过时说明没有可用节点
+	skipped := 0
+	for !cur.server.Available() {
+		skipped++
+		if skipped > lb.nodeNum {
+			return nil, sysPrint.ErrNoServer
+		}
 		lb.prevNode.next = cur.next
 		lb.backupHeadInsert(cur)
 		cur = lb.prevNode.next
@@ -42,3 +42,29 @@ func BenchmarkSelectNode(b *testing.B) {
 	}
 
 }
+
+// BenchmarkSelectNodeSmallPool 少量服务器场景，与 SmoothRoundRobinLB 对比时使用
+func BenchmarkSelectNodeSmallPool(b *testing.B) {
+	loadBalancer = CreateRRLB()
+	for i := 0; i < 10; i++ {
+		addr := testHost + ":" + strconv.Itoa(testServerPort)
+		testServerPort++
+		s, err := server.NewServer(addr, int32(rand.Intn(maxWeight)+1), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := loadBalancer.SelectNode()
+		if err != nil {
+			b.Error(err)
+		}
+	}
+
+}
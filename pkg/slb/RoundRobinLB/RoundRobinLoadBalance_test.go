@@ -178,3 +178,100 @@ func TestDeleteServerNode(t *testing.T) {
 		t.Errorf("expect no server error,but error is nil")
 	}
 }
+
+// inList 检查服务器节点是否在链表中
+func inList(ls *list, s *server.Server) bool {
+	for p := ls.head.next; p != nil; p = p.next {
+		if p.server == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOnServerUpdate(t *testing.T) {
+	lb := CreateRRLB()
+	a, err := server.NewServer("127.0.0.1:20001", 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := server.NewServer("127.0.0.1:20002", 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*server.Server{a, b} {
+		err = lb.AddServerNode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 头插法，b 先被选择，之后 b 进入 backupList
+	s, err := lb.SelectNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != b {
+		t.Fatalf("expect server:%s, actual:%s", b.Addr(), s.Addr())
+	}
+
+	// 权重变更立即生效：a 本轮剩余次数由 1 增加到 3
+	err = a.SetWeight(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.OnServerUpdate(a, server.WeightChanged)
+	for i := 0; i < 3; i++ {
+		s, err = lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != a {
+			t.Fatalf("selection %d expect server:%s, actual:%s", i, a.Addr(), s.Addr())
+		}
+	}
+
+	// 主观下线的节点立即移入 backupList
+	lb.SelectNode()
+	a.SetPfail(server.IS_PFAIL)
+	lb.OnServerUpdate(a, server.PfailChanged)
+	if inList(&lb.currentList, a) || !inList(&lb.backupList, a) {
+		t.Error("pfail server should be moved to backupList")
+	}
+	for i := 0; i < 10; i++ {
+		s, err = lb.SelectNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s == a {
+			t.Fatalf("selected pfail server:%s", a.Addr())
+		}
+	}
+
+	// 恢复上线的节点立即移回 currentList，并成为下一个被选择的节点
+	a.SetPfail(server.NOT_PFAIL)
+	lb.OnServerUpdate(a, server.PfailChanged)
+	if !inList(&lb.currentList, a) || inList(&lb.backupList, a) {
+		t.Error("recovered server should be moved back to currentList")
+	}
+	s, err = lb.SelectNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != a {
+		t.Errorf("expect recovered server:%s, actual:%s", a.Addr(), s.Addr())
+	}
+
+	// 排空的节点立即移入 backupList
+	a.SetDrain(true)
+	lb.OnServerUpdate(a, server.DrainChanged)
+	if inList(&lb.currentList, a) {
+		t.Error("draining server should be moved to backupList")
+	}
+	b.SetDrain(true)
+	lb.OnServerUpdate(b, server.DrainChanged)
+	_, err = lb.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Errorf("expect error:%v, actual:%v", sysPrint.ErrNoServer, err)
+	}
+}
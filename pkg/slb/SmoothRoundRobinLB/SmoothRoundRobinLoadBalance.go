@@ -0,0 +1,121 @@
+// Nginx Smooth Weighted Round Robin Load Balance
+
+package SmoothRoundRobinLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"sync"
+)
+
+type node struct {
+	server        *server.Server
+	currentWeight int64 // 当前权重
+}
+
+// SWRRLB Smooth Weighted Round Robin Load Balancer
+type SWRRLB struct {
+	nodeList  []*node                // 服务器节点列表
+	serverMap map[*server.Server]int // Key-value: server-nodeList索引 哈希表
+	lock      sync.Mutex             // 互斥锁
+}
+
+// CreateSWRRLB 创建一个 Smooth Weighted Round Robin Load Balancer
+func CreateSWRRLB() *SWRRLB {
+	return &SWRRLB{
+		nodeList:  make([]*node, 0),
+		serverMap: make(map[*server.Server]int, 0),
+		lock:      sync.Mutex{},
+	}
+}
+
+// Reset 重置负载均衡器
+func (lb *SWRRLB) Reset() {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lb.nodeList = make([]*node, 0)
+	lb.serverMap = make(map[*server.Server]int, 0)
+}
+
+// AddServerNode 向负载均衡器添加一个服务器节点
+func (lb *SWRRLB) AddServerNode(serverNode *server.Server) error {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	if _, ok := lb.serverMap[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	lb.nodeList = append(lb.nodeList, &node{server: serverNode})
+	lb.serverMap[serverNode] = len(lb.nodeList) - 1
+	return nil
+}
+
+// DeleteServerNode 从负载均衡器中删除一个服务器节点
+// 将最后一个节点移动到被删除节点的位置，时间复杂度 O(1)
+func (lb *SWRRLB) DeleteServerNode(serverNode *server.Server) error {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	idx, ok := lb.serverMap[serverNode]
+	if !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	delete(lb.serverMap, serverNode)
+
+	last := len(lb.nodeList) - 1
+	if idx != last {
+		lb.nodeList[idx] = lb.nodeList[last]
+		lb.serverMap[lb.nodeList[idx].server] = idx
+	}
+	lb.nodeList[last] = nil
+	lb.nodeList = lb.nodeList[:last]
+	return nil
+}
+
+// InitServerNode 重置负载均衡器，并使用 serverNodeList 中的服务器节点进行初始化
+func (lb *SWRRLB) InitServerNode(serverNodeList []*server.Server) error {
+	lb.Reset()
+	for _, s := range serverNodeList {
+		err := lb.AddServerNode(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnServerUpdate 选择时实时读取服务器的有效权重与可用状态，
+// 状态变更时将该节点的当前权重清零，避免变更前累积的当前权重使其在短时间内被连续选中或长时间不被选中
+func (lb *SWRRLB) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	if idx, ok := lb.serverMap[serverNode]; ok {
+		lb.nodeList[idx].currentWeight = 0
+	}
+}
+
+// SelectNode 通过平滑加权轮询算法选择一个服务器节点，时间复杂度 O(n)
+// 每次选择时所有可用节点的当前权重加上各自的权重，选出当前权重最大的节点，并将其当前权重减去总权重，
+// 使得权重较高的节点被均匀地穿插选中，而不是连续选中。被主观认为下线或排空的节点不参与本轮计算，
+// 处于慢启动阶段的节点使用其有效权重
+func (lb *SWRRLB) SelectNode() (*server.Server, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	var best *node
+	var total int64
+	for _, n := range lb.nodeList {
+		if !n.server.Available() {
+			continue
+		}
+		weight := int64(n.server.EffectiveWeight())
+		n.currentWeight += weight
+		total += weight
+		if best == nil || n.currentWeight > best.currentWeight {
+			best = n
+		}
+	}
+	if best == nil {
+		return nil, sysPrint.ErrNoServer
+	}
+	best.currentWeight -= total
+	return best.server, nil
+}
@@ -0,0 +1,222 @@
+package SmoothRoundRobinLB
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"log"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	SelectNodeTestCount = 100000
+	DeleteNodeTestCount = 100000
+)
+
+var (
+	testAddr       = []string{"127.0.0.1:10001", "127.0.0.1:10002", "127.0.0.1:10003"}
+	testWeights    = []int32{5, 1, 1}
+	serverCount    = len(testWeights)
+	testServerList = make([]*server.Server, 0)
+	loadBalancer   *SWRRLB
+)
+
+func init() {
+	loadBalancer = CreateSWRRLB()
+}
+
+func TestAddServerNode(t *testing.T) {
+	if len(testWeights) != len(testAddr) {
+		panic("testWeights' length must equal to testAddr's length")
+	}
+	for i := 0; i < serverCount; i++ {
+		s, err := server.NewServer(testAddr[i], testWeights[i], "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = loadBalancer.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		testServerList = append(testServerList, s)
+	}
+
+	for i, n := range loadBalancer.nodeList {
+		if n.server != testServerList[i] {
+			t.Errorf("unexpected server node at index %d, expect %s, actual %s", i, testServerList[i].Addr(), n.server.Addr())
+		}
+		if loadBalancer.serverMap[n.server] != i {
+			t.Errorf("unexpected server index, expect %d, actual %d", i, loadBalancer.serverMap[n.server])
+		}
+	}
+
+	err := loadBalancer.AddServerNode(testServerList[0])
+	if err == nil {
+		t.Error("Adding the same node repeatedly should fail.")
+	}
+
+	// test InitServerNode
+	err = loadBalancer.InitServerNode(testServerList)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(loadBalancer.nodeList) != serverCount {
+		t.Errorf("unexpected node count, expect %d, actual %d", serverCount, len(loadBalancer.nodeList))
+	}
+}
+
+func TestSelectNode(t *testing.T) {
+	// 权重 5/1/1 时的平滑加权轮询序列
+	expectedAddr := []string{testAddr[0], testAddr[0], testAddr[1], testAddr[0], testAddr[2], testAddr[0], testAddr[0]}
+	for k := 0; k < 3; k++ {
+		for i := 0; i < len(expectedAddr); i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() != expectedAddr[i] {
+				t.Errorf("unequal testAddr. round %d index %d, expect %s, actual %s", k, i, expectedAddr[i], s.Addr())
+			}
+		}
+	}
+
+	// 每轮随机一个节点为主观下线状态
+	for k := 0; k < SelectNodeTestCount; k++ {
+		failIdx := rand.Intn(serverCount)
+		testServerList[failIdx].SetPfail(server.IS_PFAIL)
+		for i := 0; i < serverCount; i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() == testServerList[failIdx].Addr() {
+				t.Errorf("Selected server that is considered subjective fail. addr:%s", s.Addr())
+			}
+		}
+		testServerList[failIdx].SetPfail(server.NOT_PFAIL)
+	}
+
+	// 全部节点主观下线
+	for _, s := range testServerList {
+		s.SetPfail(server.IS_PFAIL)
+	}
+	_, err := loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Errorf("expect no server error, actual:%v", err)
+	}
+	for _, s := range testServerList {
+		s.SetPfail(server.NOT_PFAIL)
+	}
+}
+
+func TestSelectNodeDistribution(t *testing.T) {
+	servers := make([]*server.Server, 0)
+	lb := CreateSWRRLB()
+	var weightSum int32
+	for i := 0; i < 10; i++ {
+		s, err := server.NewServer("127.0.0.1:"+strconv.Itoa(20001+i), int32(i+1), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = lb.AddServerNode(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, s)
+		weightSum += s.Weight()
+	}
+
+	// 每完成一个完整周期，各节点被选中次数应恰好等于其权重
+	cnt := make(map[*server.Server]int32, 0)
+	for i := int32(0); i < weightSum; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		cnt[s]++
+	}
+	for _, s := range servers {
+		if cnt[s] != s.Weight() {
+			t.Errorf("server %s weight %d, selected %d times", s.Addr(), s.Weight(), cnt[s])
+		}
+	}
+}
+
+func TestDeleteServerNode(t *testing.T) {
+	for k := 0; k < DeleteNodeTestCount; k++ {
+		DelIdx := rand.Intn(serverCount)
+		err := loadBalancer.DeleteServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+		for i := 0; i < serverCount; i++ {
+			s, err := loadBalancer.SelectNode()
+			if err != nil {
+				t.Error(err)
+			}
+			if s.Addr() == testServerList[DelIdx].Addr() {
+				t.Errorf("Selected server that is deleted. addr:%s", s.Addr())
+			}
+		}
+		err = loadBalancer.AddServerNode(testServerList[DelIdx])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// 删除所有节点
+	for i := 0; i < serverCount; i++ {
+		err := loadBalancer.DeleteServerNode(testServerList[i])
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err := loadBalancer.SelectNode()
+	if err != sysPrint.ErrNoServer {
+		t.Error(err)
+	}
+}
+
+func TestSelectNodeSlowStart(t *testing.T) {
+	lb := CreateSWRRLB()
+	warm, err := server.NewServer("127.0.0.1:20001", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold, err := server.NewServer("127.0.0.1:20002", 100, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	cold.SetSlowStart(time.Hour)
+	cold.StartSlowStart()
+	err = lb.InitServerNode([]*server.Server{warm, cold})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 慢启动刚开始时，有效权重为权重的 SlowStartMinFactor
+	effective := cold.EffectiveWeight()
+	if effective != int32(100*server.SlowStartMinFactor) {
+		t.Errorf("unexpected effective weight, expect %d, actual %d", int32(100*server.SlowStartMinFactor), effective)
+	}
+	cnt := make(map[*server.Server]int32, 0)
+	for i := int32(0); i < warm.Weight()+effective; i++ {
+		s, err := lb.SelectNode()
+		if err != nil {
+			t.Error(err)
+		}
+		cnt[s]++
+	}
+	if cnt[cold] != effective {
+		t.Errorf("server in slow start selected %d times, expect %d", cnt[cold], effective)
+	}
+
+	// 慢启动结束后恢复为完整权重
+	cold.SetSlowStart(time.Nanosecond)
+	if cold.EffectiveWeight() != cold.Weight() || cold.InSlowStart() {
+		t.Errorf("slow start should be finished, effective weight %d", cold.EffectiveWeight())
+	}
+}
@@ -0,0 +1,43 @@
+package slb
+
+import (
+	"EH-Proxy/pkg/slb/AliasLB"
+	"EH-Proxy/pkg/slb/ConsistentHashLB"
+	"EH-Proxy/pkg/slb/LeastActiveLB"
+	"EH-Proxy/pkg/slb/MaglevLB"
+	"EH-Proxy/pkg/slb/PeakEwmaLB"
+	"EH-Proxy/pkg/slb/RandomLB"
+	"EH-Proxy/pkg/slb/RoundRobinLB"
+	"EH-Proxy/pkg/slb/SmoothRoundRobinLB"
+)
+
+// 注册内置负载均衡器
+func init() {
+	Register(RoundRobin, func(opts map[string]any) LoadBalancer {
+		return RoundRobinLB.CreateRRLB()
+	})
+	Register(SmoothRoundRobin, func(opts map[string]any) LoadBalancer {
+		return SmoothRoundRobinLB.CreateSWRRLB()
+	})
+	Register(Random, func(opts map[string]any) LoadBalancer {
+		return RandomLB.CreateRDLBWithMaxRetry(OptionInt(opts, "max-retry", RandomLB.DEFAULT_MAXRETRY))
+	})
+	Register(AliasRandom, func(opts map[string]any) LoadBalancer {
+		return AliasLB.CreateALLBWithMaxRetry(OptionInt(opts, "max-retry", AliasLB.DEFAULT_SLOW_START_RETRY))
+	})
+	Register(LeastActive, func(opts map[string]any) LoadBalancer {
+		return LeastActiveLB.CreateLALB()
+	})
+	Register(WeightedLeastActive, func(opts map[string]any) LoadBalancer {
+		return LeastActiveLB.CreateWeightedLALB()
+	})
+	Register(PeakEwma, func(opts map[string]any) LoadBalancer {
+		return PeakEwmaLB.CreatePELB()
+	})
+	Register(ConsistentHash, func(opts map[string]any) LoadBalancer {
+		return ConsistentHashLB.CreateCHLBWithVirtualNodes(OptionInt(opts, "virtual-nodes", ConsistentHashLB.DEFAULT_VIRTUAL_NODES))
+	})
+	Register(Maglev, func(opts map[string]any) LoadBalancer {
+		return MaglevLB.CreateMGLBWithTableSize(OptionInt(opts, "table-size", MaglevLB.DEFAULT_TABLE_SIZE))
+	})
+}
@@ -0,0 +1,33 @@
+// Package sample Power of 2 choices 类负载均衡器共用的随机采样
+
+package sample
+
+import (
+	"EH-Proxy/pkg/server"
+	"math/rand"
+)
+
+// RandomAvailable 从 servers 中随机选取一个可用（见 server.Server.Available）且不等于 exclude 的服务器，没有时返回 nil
+// 先随机采样至多 maxRetry+1 次，仍未选中时降级成随机起点轮询
+func RandomAvailable(servers []*server.Server, exclude *server.Server, maxRetry int) *server.Server {
+	n := len(servers)
+	if n == 0 {
+		return nil
+	}
+	for i := 0; i <= maxRetry; i++ {
+		s := servers[rand.Intn(n)]
+		if s != exclude && s.Available() {
+			return s
+		}
+	}
+
+	// 达到最大重试次数未能成功获取可用节点，降级成随机起点轮询
+	idx := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		s := servers[(idx+i)%n]
+		if s != exclude && s.Available() {
+			return s
+		}
+	}
+	return nil
+}
@@ -2,18 +2,23 @@ package slb
 
 import (
 	"EH-Proxy/pkg/server"
-	"EH-Proxy/pkg/slb/LeastActiveLB"
-	"EH-Proxy/pkg/slb/RandomLB"
-	"EH-Proxy/pkg/slb/RoundRobinLB"
 	"EH-Proxy/pkg/system/sysPrint"
+	"sort"
+	"sync"
 )
 
 type LoadBalancerType string
 
 const (
-	RoundRobin  LoadBalancerType = "round-robin"
-	Random      LoadBalancerType = "random"
-	LeastActive LoadBalancerType = "least-active"
+	RoundRobin          LoadBalancerType = "round-robin"
+	Random              LoadBalancerType = "random"
+	LeastActive         LoadBalancerType = "least-active"
+	ConsistentHash      LoadBalancerType = "consistent-hash"
+	SmoothRoundRobin    LoadBalancerType = "smooth-round-robin"
+	PeakEwma            LoadBalancerType = "peak-ewma"
+	Maglev              LoadBalancerType = "maglev"
+	WeightedLeastActive LoadBalancerType = "weighted-least-active"
+	AliasRandom         LoadBalancerType = "alias-random"
 )
 
 type LoadBalancer interface {
@@ -22,18 +27,62 @@ type LoadBalancer interface {
 	SelectNode() (*server.Server, error)
 	Reset()
 	InitServerNode([]*server.Server) error
+
+	// OnServerUpdate 服务器权重、主观下线状态或排空状态变更时调用，负载均衡器应立即更新内部缓存的数据结构，
+	// serverNode 不在负载均衡器中时忽略
+	OnServerUpdate(serverNode *server.Server, change server.ChangeType)
+}
+
+// KeyedLoadBalancer 根据请求的哈希键选择节点的负载均衡器（如一致性哈希）
+type KeyedLoadBalancer interface {
+	LoadBalancer
+	SelectNodeByKey(key string) (*server.Server, error)
+}
+
+// LoadBalancerConstructor 负载均衡器构造函数
+// opts 为配置文件 load-balancer-options 中该负载均衡器类型对应的选项，未配置时为 nil
+type LoadBalancerConstructor func(opts map[string]any) LoadBalancer
+
+var (
+	registry     = make(map[LoadBalancerType]LoadBalancerConstructor)
+	registryLock sync.RWMutex
+)
+
+// Register 注册一个负载均衡器类型，注册后即可在配置文件或 SetLoadBalancer 命令中使用该类型
+// 通常在负载均衡器所在包的 init 函数中调用，重复注册同一类型或 ctor 为 nil 时 panic
+func Register(name LoadBalancerType, ctor LoadBalancerConstructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if ctor == nil {
+		panic("slb: Register constructor is nil for load balancer " + string(name))
+	}
+	if _, exists := registry[name]; exists {
+		panic("slb: Register called twice for load balancer " + string(name))
+	}
+	registry[name] = ctor
+}
+
+// RegisteredTypes 返回所有已注册的负载均衡器类型，按名称排序
+func RegisteredTypes() []LoadBalancerType {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	types := make([]LoadBalancerType, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
 }
 
-// LoadBalancerFactory 创建一个 balancerType 指定类型的负载均衡器
-func LoadBalancerFactory(balancerType LoadBalancerType) (LoadBalancer, error) {
-	switch balancerType {
-	case RoundRobin:
-		return RoundRobinLB.CreateRRLB(), nil
-	case Random:
-		return RandomLB.CreateRDLB(), nil
-	case LeastActive:
-		return LeastActiveLB.CreateLALB(), nil
-	default:
+// LoadBalancerFactory 创建一个 balancerType 指定类型的负载均衡器，opts 为该负载均衡器的选项
+func LoadBalancerFactory(balancerType LoadBalancerType, opts map[string]any) (LoadBalancer, error) {
+	registryLock.RLock()
+	ctor, ok := registry[balancerType]
+	registryLock.RUnlock()
+	if !ok {
 		return nil, sysPrint.ErrUnknownLoadBalancer
 	}
+	return ctor(opts), nil
 }
@@ -0,0 +1,71 @@
+package slb
+
+import (
+	"EH-Proxy/pkg/slb/RoundRobinLB"
+	"EH-Proxy/pkg/system/sysPrint"
+	"testing"
+)
+
+func TestLoadBalancerFactory(t *testing.T) {
+	builtin := []LoadBalancerType{RoundRobin, Random, LeastActive, ConsistentHash, SmoothRoundRobin, PeakEwma, Maglev, WeightedLeastActive, AliasRandom}
+	for _, balancerType := range builtin {
+		lb, err := LoadBalancerFactory(balancerType, nil)
+		if err != nil {
+			t.Errorf("create load balancer %s error:%v", balancerType, err)
+		}
+		if lb == nil {
+			t.Errorf("load balancer %s is nil", balancerType)
+		}
+	}
+
+	_, err := LoadBalancerFactory("unknown", nil)
+	if err != sysPrint.ErrUnknownLoadBalancer {
+		t.Errorf("expect unknown load balancer error, actual:%v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const custom LoadBalancerType = "test-custom"
+	var receivedOpts map[string]any
+	Register(custom, func(opts map[string]any) LoadBalancer {
+		receivedOpts = opts
+		return RoundRobinLB.CreateRRLB()
+	})
+
+	opts := map[string]any{"max-retry": 5, "table-size": "1031", "decay": "10s"}
+	_, err := LoadBalancerFactory(custom, opts)
+	if err != nil {
+		t.Error(err)
+	}
+	if OptionInt(receivedOpts, "max-retry", 0) != 5 {
+		t.Errorf("expect option max-retry:5, actual:%v", receivedOpts["max-retry"])
+	}
+	if OptionInt(receivedOpts, "table-size", 0) != 1031 {
+		t.Errorf("expect option table-size:1031, actual:%v", receivedOpts["table-size"])
+	}
+	if OptionDuration(receivedOpts, "decay", 0).Seconds() != 10 {
+		t.Errorf("expect option decay:10s, actual:%v", receivedOpts["decay"])
+	}
+	if OptionInt(receivedOpts, "not-exists", 7) != 7 {
+		t.Error("missing option should return default value")
+	}
+
+	found := false
+	for _, balancerType := range RegisteredTypes() {
+		if balancerType == custom {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("load balancer %s not in registered types", custom)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering the same load balancer type repeatedly should panic.")
+		}
+	}()
+	Register(custom, func(opts map[string]any) LoadBalancer {
+		return RoundRobinLB.CreateRRLB()
+	})
+}
@@ -0,0 +1,61 @@
+package slb
+
+import (
+	"strconv"
+	"time"
+)
+
+// OptionInt 读取整数类型的负载均衡器选项，选项不存在或无法解析时返回 defaultValue
+func OptionInt(opts map[string]any, key string, defaultValue int) int {
+	switch v := opts[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+// OptionFloat 读取浮点数类型的负载均衡器选项，选项不存在或无法解析时返回 defaultValue
+func OptionFloat(opts map[string]any, key string, defaultValue float64) float64 {
+	switch v := opts[key].(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// OptionString 读取字符串类型的负载均衡器选项，选项不存在时返回 defaultValue
+func OptionString(opts map[string]any, key string, defaultValue string) string {
+	if v, ok := opts[key].(string); ok {
+		return v
+	}
+	return defaultValue
+}
+
+// OptionDuration 读取时间间隔类型的负载均衡器选项（如 "10s"），选项不存在或无法解析时返回 defaultValue
+func OptionDuration(opts map[string]any, key string, defaultValue time.Duration) time.Duration {
+	switch v := opts[key].(type) {
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	case int:
+		return time.Duration(v)
+	}
+	return defaultValue
+}
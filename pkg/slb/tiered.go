@@ -0,0 +1,185 @@
+package slb
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"sort"
+	"sync"
+)
+
+// tier 同一优先级的服务器及其负载均衡器
+type tier struct {
+	priority int32        // 优先级
+	lb       LoadBalancer // 该优先级的负载均衡器
+	size     int          // 服务器数目
+}
+
+// TieredLoadBalancer 按服务器优先级分层的负载均衡器
+// 每个优先级使用一个独立的内部负载均衡器，只有当更高优先级的所有服务器均被主观认为下线或排空时，
+// 才会选择较低优先级的服务器，因此备用服务器在主服务器健康时不会接收任何请求
+type TieredLoadBalancer struct {
+	tiers      []*tier                  // 按优先级从高到低（priority 升序）排列
+	serverTier map[*server.Server]*tier // Key-value: server-所在层 哈希表
+	rwLock     sync.RWMutex             // 读写锁
+	newTier    func() LoadBalancer      // 创建某一层的内部负载均衡器
+}
+
+// NewTieredLoadBalancer 创建一个按优先级分层的负载均衡器，newTier 用于为每个优先级创建内部负载均衡器
+func NewTieredLoadBalancer(newTier func() LoadBalancer) *TieredLoadBalancer {
+	return &TieredLoadBalancer{
+		tiers:      make([]*tier, 0),
+		serverTier: make(map[*server.Server]*tier),
+		rwLock:     sync.RWMutex{},
+		newTier:    newTier,
+	}
+}
+
+// TieredLoadBalancerFactory 创建一个按优先级分层的负载均衡器，每一层均为 balancerType 类型
+func TieredLoadBalancerFactory(balancerType LoadBalancerType, opts map[string]any) (LoadBalancer, error) {
+	_, err := LoadBalancerFactory(balancerType, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewTieredLoadBalancer(func() LoadBalancer {
+		lb, _ := LoadBalancerFactory(balancerType, opts)
+		return lb
+	}), nil
+}
+
+// Reset 重置负载均衡器
+func (lb *TieredLoadBalancer) Reset() {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	lb.tiers = make([]*tier, 0)
+	lb.serverTier = make(map[*server.Server]*tier)
+}
+
+// getOrCreateTier 获取优先级对应的层，不存在则创建并按优先级插入，调用方需持有写锁
+func (lb *TieredLoadBalancer) getOrCreateTier(priority int32) *tier {
+	idx := sort.Search(len(lb.tiers), func(i int) bool {
+		return lb.tiers[i].priority >= priority
+	})
+	if idx < len(lb.tiers) && lb.tiers[idx].priority == priority {
+		return lb.tiers[idx]
+	}
+	t := &tier{priority: priority, lb: lb.newTier()}
+	lb.tiers = append(lb.tiers, nil)
+	copy(lb.tiers[idx+1:], lb.tiers[idx:])
+	lb.tiers[idx] = t
+	return t
+}
+
+// removeTier 移除空的层，调用方需持有写锁
+func (lb *TieredLoadBalancer) removeTier(t *tier) {
+	for i := range lb.tiers {
+		if lb.tiers[i] == t {
+			lb.tiers = append(lb.tiers[:i], lb.tiers[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddServerNode 根据服务器的优先级将其添加到对应层的负载均衡器
+func (lb *TieredLoadBalancer) AddServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	if _, ok := lb.serverTier[serverNode]; ok {
+		return sysPrint.ErrServerExists
+	}
+	t := lb.getOrCreateTier(serverNode.Priority())
+	err := t.lb.AddServerNode(serverNode)
+	if err != nil {
+		if t.size == 0 {
+			lb.removeTier(t)
+		}
+		return err
+	}
+	t.size++
+	lb.serverTier[serverNode] = t
+	return nil
+}
+
+// DeleteServerNode 从所在层的负载均衡器中删除服务器节点，层为空时移除该层
+func (lb *TieredLoadBalancer) DeleteServerNode(serverNode *server.Server) error {
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	t, ok := lb.serverTier[serverNode]
+	if !ok {
+		return sysPrint.ErrServerNotExists
+	}
+	err := t.lb.DeleteServerNode(serverNode)
+	if err != nil {
+		return err
+	}
+	delete(lb.serverTier, serverNode)
+	t.size--
+	if t.size == 0 {
+		lb.removeTier(t)
+	}
+	return nil
+}
+
+// InitServerNode 重置负载均衡器，按优先级分组后分别初始化各层的负载均衡器
+func (lb *TieredLoadBalancer) InitServerNode(serverNodeList []*server.Server) error {
+	lb.Reset()
+	lb.rwLock.Lock()
+	defer lb.rwLock.Unlock()
+	groups := make(map[*tier][]*server.Server)
+	for _, s := range serverNodeList {
+		if _, ok := lb.serverTier[s]; ok {
+			return sysPrint.ErrServerExists
+		}
+		t := lb.getOrCreateTier(s.Priority())
+		groups[t] = append(groups[t], s)
+		lb.serverTier[s] = t
+	}
+	for t, list := range groups {
+		err := t.lb.InitServerNode(list)
+		if err != nil {
+			return err
+		}
+		t.size = len(list)
+	}
+	return nil
+}
+
+// SelectNode 从优先级最高的层开始选择，当前层没有可用服务器时才尝试下一层
+func (lb *TieredLoadBalancer) SelectNode() (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	for _, t := range lb.tiers {
+		s, err := t.lb.SelectNode()
+		if err != sysPrint.ErrNoServer {
+			return s, err
+		}
+	}
+	return nil, sysPrint.ErrNoServer
+}
+
+// SelectNodeByKey 从优先级最高的层开始根据 key 选择，内部负载均衡器不支持按 key 选择时使用 SelectNode
+func (lb *TieredLoadBalancer) SelectNodeByKey(key string) (*server.Server, error) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	for _, t := range lb.tiers {
+		var s *server.Server
+		var err error
+		if keyedLB, ok := t.lb.(KeyedLoadBalancer); ok {
+			s, err = keyedLB.SelectNodeByKey(key)
+		} else {
+			s, err = t.lb.SelectNode()
+		}
+		if err != sysPrint.ErrNoServer {
+			return s, err
+		}
+	}
+	return nil, sysPrint.ErrNoServer
+}
+
+// OnServerUpdate 将服务器状态变更通知其所在层的负载均衡器
+func (lb *TieredLoadBalancer) OnServerUpdate(serverNode *server.Server, change server.ChangeType) {
+	lb.rwLock.RLock()
+	defer lb.rwLock.RUnlock()
+	if t, ok := lb.serverTier[serverNode]; ok {
+		t.lb.OnServerUpdate(serverNode, change)
+	}
+}
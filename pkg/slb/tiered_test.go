@@ -0,0 +1,131 @@
+package slb
+
+import (
+	"EH-Proxy/pkg/server"
+	"EH-Proxy/pkg/system/sysPrint"
+	"strconv"
+	"testing"
+)
+
+const (
+	tieredPrimaryNum = 3
+	tieredBackupNum  = 2
+	tieredSelectNum  = 3000
+)
+
+// createTieredServers 创建 tieredPrimaryNum 个优先级为 0 的服务器与 tieredBackupNum 个备用服务器
+func createTieredServers(t *testing.T) ([]*server.Server, []*server.Server) {
+	primaries := make([]*server.Server, 0, tieredPrimaryNum)
+	backups := make([]*server.Server, 0, tieredBackupNum)
+	for i := 0; i < tieredPrimaryNum+tieredBackupNum; i++ {
+		s, err := server.NewServer("127.0.0.1:"+strconv.Itoa(20001+i), server.DefaultWeight, server.NoHealthCheck)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < tieredPrimaryNum {
+			primaries = append(primaries, s)
+		} else {
+			s.SetPriority(server.BackupPriority)
+			backups = append(backups, s)
+		}
+	}
+	return primaries, backups
+}
+
+func TestTieredLoadBalancer(t *testing.T) {
+	for _, balancerType := range []LoadBalancerType{RoundRobin, Random, LeastActive} {
+		lb, err := TieredLoadBalancerFactory(balancerType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		primaries, backups := createTieredServers(t)
+		for _, s := range append(backups, primaries...) {
+			err = lb.AddServerNode(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// 主服务器健康时备用服务器不接收任何请求
+		for i := 0; i < tieredSelectNum; i++ {
+			s, err := lb.SelectNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.IsBackup() {
+				t.Fatalf("%s: backup server %s selected while primaries are healthy", balancerType, s.Addr())
+			}
+		}
+
+		// 主服务器全部下线或排空时选择备用服务器
+		primaries[0].SetPfail(server.IS_PFAIL)
+		primaries[1].SetPfail(server.IS_PFAIL)
+		primaries[2].SetDrain(true)
+		for i := 0; i < tieredSelectNum; i++ {
+			s, err := lb.SelectNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.IsBackup() {
+				t.Fatalf("%s: primary server %s selected while all primaries are unavailable", balancerType, s.Addr())
+			}
+		}
+
+		// 主服务器恢复后不再选择备用服务器
+		primaries[2].SetDrain(false)
+		for i := 0; i < tieredSelectNum; i++ {
+			s, err := lb.SelectNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != primaries[2] {
+				t.Fatalf("%s: expect server %s, actual:%s", balancerType, primaries[2].Addr(), s.Addr())
+			}
+		}
+
+		// 所有服务器均不可用
+		primaries[2].SetPfail(server.IS_PFAIL)
+		for _, s := range backups {
+			s.SetDrain(true)
+		}
+		_, err = lb.SelectNode()
+		if err != sysPrint.ErrNoServer {
+			t.Errorf("%s: expect error:%v, actual:%v", balancerType, sysPrint.ErrNoServer, err)
+		}
+	}
+}
+
+func TestTieredLoadBalancerDeleteServerNode(t *testing.T) {
+	lb := NewTieredLoadBalancer(func() LoadBalancer {
+		l, _ := LoadBalancerFactory(RoundRobin, nil)
+		return l
+	})
+	primaries, backups := createTieredServers(t)
+	err := lb.InitServerNode(append(primaries, backups...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lb.tiers) != 2 {
+		t.Fatalf("expect tier count:2, actual:%d", len(lb.tiers))
+	}
+	for _, s := range primaries {
+		err = lb.DeleteServerNode(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(lb.tiers) != 1 {
+		t.Errorf("empty tier should be removed, tier count:%d", len(lb.tiers))
+	}
+	err = lb.DeleteServerNode(primaries[0])
+	if err != sysPrint.ErrServerNotExists {
+		t.Errorf("expect error:%v, actual:%v", sysPrint.ErrServerNotExists, err)
+	}
+	s, err := lb.SelectNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsBackup() {
+		t.Errorf("expect backup server, actual:%s", s.Addr())
+	}
+}
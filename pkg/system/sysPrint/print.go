@@ -21,6 +21,20 @@ var (
 	ErrServerWeightGreaterThanMax = ErrorMsg("Server weight cannot greater than max limit 1000000.")
 	ErrServerAddrInvalid          = ErrorMsg("Server address invalid.")
 	ErrServerProbeInvalid         = ErrorMsg("Server probe invalid, probe must have an HTTP scheme, for example: http://127.0.0.1:8081/check/")
+	ErrGroupExists                = ErrorMsg("Server group already exists.")
+	ErrGroupNotExists             = ErrorMsg("Server group does not exists.")
+	ErrMatchConditionInvalid      = ErrorMsg("Match condition invalid, at most one of exact, prefix and regex can be set.")
+	ErrRouteExists                = ErrorMsg("Route already exists.")
+	ErrRouteNotExists             = ErrorMsg("Route does not exists.")
+	ErrSplitNotConfigured         = ErrorMsg("Route has no traffic split.")
+	ErrSplitWeightInvalid         = ErrorMsg("Split weight invalid, weights cannot be negative and the total weight must be greater than 0.")
+	ErrMirrorPercentInvalid       = ErrorMsg("Mirror percent must be between 0 and 100.")
+	ErrPathPatternInvalid         = ErrorMsg("Path pattern invalid, for example: /users/:id, /users/:id<[0-9]+>, /users/*/profile, /static/**")
+	ErrPathPatternExists          = ErrorMsg("Path pattern already exists.")
+	ErrUrlPathExists              = ErrorMsg("URL path already exists.")
+	ErrUrlPathNotExists           = ErrorMsg("URL path does not exists.")
+	ErrUrlPathCheckModeInvalid    = ErrorMsg("URL path check mode must be allow or deny.")
+	ErrUrlPathResponseInvalid     = ErrorMsg("URL path response invalid, status must be between 200 and 599, and must be 3xx when location is set.")
 )
 
 var (
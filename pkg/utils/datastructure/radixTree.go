@@ -0,0 +1,290 @@
+package datastructure
+
+import (
+	"EH-Proxy/pkg/system/sysPrint"
+	"regexp"
+	"strings"
+)
+
+// segmentKind 路径段类型，同一位置多个子节点都能匹配时按类型顺序尝试，即静态路径段优先级最高，** 最低
+type segmentKind uint8
+
+const (
+	staticSegment   segmentKind = iota // 静态路径段，如 users
+	regexSegment                       // 带正则表达式的参数路径段，如 :id<[0-9]+>，正则表达式需完全匹配路径段
+	paramSegment                       // 参数路径段，如 :id 或 *，匹配任意非空路径段
+	catchAllSegment                    // 通配路径段，如 ** 或 **file，匹配剩余的零个或多个路径段，只能位于模式末尾
+)
+
+// segment 解析后的模式路径段
+type segment struct {
+	kind  segmentKind
+	text  string // 静态路径段的内容，或参数名（* 与 ** 的参数名为空）
+	expr  string // 正则表达式
+	regex *regexp.Regexp
+}
+
+// parsePattern 将路径模式解析为路径段，模式需以 / 开头
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, sysPrint.ErrPathPatternInvalid
+	}
+	parts := strings.Split(pattern[1:], "/")
+	segs := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, "**"):
+			if i != len(parts)-1 {
+				return nil, sysPrint.ErrPathPatternInvalid
+			}
+			segs = append(segs, segment{kind: catchAllSegment, text: part[2:]})
+		case part == "*":
+			segs = append(segs, segment{kind: paramSegment})
+		case strings.HasPrefix(part, ":"):
+			name, expr := part[1:], ""
+			if idx := strings.IndexByte(name, '<'); idx >= 0 {
+				if !strings.HasSuffix(name, ">") {
+					return nil, sysPrint.ErrPathPatternInvalid
+				}
+				name, expr = name[:idx], name[idx+1:len(name)-1]
+			}
+			if name == "" {
+				return nil, sysPrint.ErrPathPatternInvalid
+			}
+			if expr == "" {
+				segs = append(segs, segment{kind: paramSegment, text: name})
+				continue
+			}
+			regex, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, segment{kind: regexSegment, text: name, expr: expr, regex: regex})
+		default:
+			segs = append(segs, segment{kind: staticSegment, text: part})
+		}
+	}
+	return segs, nil
+}
+
+// radixEntry 插入的路径模式
+type radixEntry struct {
+	pattern string
+	value   any
+}
+
+// radixNode 基数树节点，静态节点将没有分支的连续静态路径段压缩在一个节点中
+type radixNode struct {
+	kind      segmentKind
+	segments  []string              // 静态节点的路径段序列
+	name      string                // 参数节点的参数名
+	expr      string                // 正则参数节点的正则表达式
+	regex     *regexp.Regexp        // 编译后的正则表达式
+	static    map[string]*radixNode // 静态子节点，key: 子节点的第一个路径段
+	wildcards []*radixNode          // 参数与通配子节点，按类型排序
+	entry     *radixEntry           // 在该节点结束的路径模式
+}
+
+// staticChild 获取或创建静态路径段序列 run 对应的节点，必要时拆分已有节点
+func (n *radixNode) staticChild(run []string) *radixNode {
+	for len(run) > 0 {
+		child, ok := n.static[run[0]]
+		if !ok {
+			child = &radixNode{kind: staticSegment, segments: run}
+			if n.static == nil {
+				n.static = make(map[string]*radixNode)
+			}
+			n.static[run[0]] = child
+			return child
+		}
+		k := 1
+		for k < len(child.segments) && k < len(run) && child.segments[k] == run[k] {
+			k++
+		}
+		if k < len(child.segments) {
+			child.split(k)
+		}
+		n = child
+		run = run[k:]
+	}
+	return n
+}
+
+// split 将静态节点拆分为前 k 个路径段与剩余路径段两个节点
+func (n *radixNode) split(k int) {
+	tail := &radixNode{
+		kind:      staticSegment,
+		segments:  n.segments[k:],
+		static:    n.static,
+		wildcards: n.wildcards,
+		entry:     n.entry,
+	}
+	n.segments = n.segments[:k]
+	n.static = map[string]*radixNode{tail.segments[0]: tail}
+	n.wildcards = nil
+	n.entry = nil
+}
+
+// findWildcard 查找参数或通配路径段 seg 对应的子节点，不存在时返回 nil
+func (n *radixNode) findWildcard(seg segment) *radixNode {
+	for _, child := range n.wildcards {
+		if child.kind == seg.kind && child.name == seg.text && child.expr == seg.expr {
+			return child
+		}
+	}
+	return nil
+}
+
+// wildcardChild 获取或创建参数或通配路径段 seg 对应的子节点
+func (n *radixNode) wildcardChild(seg segment) *radixNode {
+	if child := n.findWildcard(seg); child != nil {
+		return child
+	}
+	child := &radixNode{kind: seg.kind, name: seg.text, expr: seg.expr, regex: seg.regex}
+	idx := len(n.wildcards)
+	for idx > 0 && n.wildcards[idx-1].kind > seg.kind {
+		idx--
+	}
+	n.wildcards = append(n.wildcards, nil)
+	copy(n.wildcards[idx+1:], n.wildcards[idx:])
+	n.wildcards[idx] = child
+	return child
+}
+
+// RadixTree 按路径段匹配 URL 路径的基数树
+// 支持的路径模式：
+//   - 静态路径段，如 /users/list
+//   - 参数路径段 :name，匹配任意非空路径段，如 /users/:id；* 为匿名的参数路径段，如 /users/*/profile
+//   - 正则参数路径段 :name<regex>，正则表达式需完全匹配路径段，如 /users/:id<[0-9]+>
+//   - 通配路径段 ** 或 **name，只能位于模式末尾，匹配剩余的零个或多个路径段，如 /static/** 匹配 /static、/static/js/app.js，
+//     但不匹配 /staticfile
+//
+// 多个模式同时匹配时选择更具体的模式，即从左到右逐段比较，
+// 静态路径段优先于正则参数路径段，正则参数路径段优先于参数路径段，参数路径段优先于通配路径段
+// RadixTree 不是并发安全的，创建完成后可以并发调用 Match；需要在运行时修改时，
+// 重新创建基数树后整体替换
+type RadixTree struct {
+	root *radixNode
+	size int
+}
+
+func NewRadixTree() *RadixTree {
+	return &RadixTree{root: &radixNode{kind: staticSegment}}
+}
+
+// Len 返回路径模式的数量
+func (t *RadixTree) Len() int {
+	return t.size
+}
+
+// Insert 插入路径模式，模式无效或已存在时返回错误
+func (t *RadixTree) Insert(pattern string, value any) error {
+	segs, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	n := t.root
+	for i := 0; i < len(segs); {
+		if segs[i].kind != staticSegment {
+			n = n.wildcardChild(segs[i])
+			i++
+			continue
+		}
+		run := make([]string, 0, len(segs)-i)
+		for ; i < len(segs) && segs[i].kind == staticSegment; i++ {
+			run = append(run, segs[i].text)
+		}
+		n = n.staticChild(run)
+	}
+	if n.entry != nil {
+		return sysPrint.ErrPathPatternExists
+	}
+	n.entry = &radixEntry{pattern: pattern, value: value}
+	t.size++
+	return nil
+}
+
+// Match 返回与 path 匹配的路径模式的值
+func (t *RadixTree) Match(path string) (any, bool) {
+	s := radixSearch{path: normalizePath(path)}
+	if !s.search(t.root, 1) {
+		return nil, false
+	}
+	return s.best.value, true
+}
+
+func normalizePath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+// nextSegment 返回从 pos 开始的路径段与下一个路径段的起始位置，没有下一个路径段时返回 len(path)+1
+func nextSegment(path string, pos int) (string, int) {
+	idx := strings.IndexByte(path[pos:], '/')
+	if idx < 0 {
+		return path[pos:], len(path) + 1
+	}
+	return path[pos : pos+idx], pos + idx + 1
+}
+
+// radixSearch 一次匹配过程的状态，按具体程度从高到低深度优先搜索，第一个匹配的模式即为最具体的模式
+type radixSearch struct {
+	path string
+	best *radixEntry
+}
+
+// search 从节点 n 开始匹配 pos 之后的路径段，pos 大于路径长度表示已没有剩余路径段，匹配成功时返回 true
+func (s *radixSearch) search(n *radixNode, pos int) bool {
+	if pos > len(s.path) {
+		if n.entry != nil {
+			s.best = n.entry
+			return true
+		}
+		for _, w := range n.wildcards {
+			if w.kind == catchAllSegment && w.entry != nil {
+				s.best = w.entry
+				return true
+			}
+		}
+		return false
+	}
+
+	seg, next := nextSegment(s.path, pos)
+	if child, ok := n.static[seg]; ok {
+		p, matched := next, true
+		for _, cs := range child.segments[1:] {
+			if p > len(s.path) {
+				matched = false
+				break
+			}
+			var sg string
+			sg, p = nextSegment(s.path, p)
+			if sg != cs {
+				matched = false
+				break
+			}
+		}
+		if matched && s.search(child, p) {
+			return true
+		}
+	}
+	for _, w := range n.wildcards {
+		switch w.kind {
+		case catchAllSegment:
+			if w.entry != nil {
+				s.best = w.entry
+				return true
+			}
+		default:
+			if seg == "" || (w.regex != nil && !w.regex.MatchString(seg)) {
+				continue
+			}
+			if s.search(w, next) {
+				return true
+			}
+		}
+	}
+	return false
+}
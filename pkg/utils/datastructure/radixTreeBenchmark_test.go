@@ -0,0 +1,90 @@
+package datastructure
+
+import (
+	"strconv"
+	"testing"
+)
+
+const (
+	benchmarkResourceNum = 200
+)
+
+// 静态路径使用静态模式，前缀路径使用 ** 模式
+var (
+	benchmarkStaticPaths = func() []string {
+		paths := make([]string, 0, benchmarkResourceNum)
+		for i := 0; i < benchmarkResourceNum; i++ {
+			paths = append(paths, "/api/v1/resource"+strconv.Itoa(i)+"/list")
+		}
+		return paths
+	}()
+	benchmarkPrefixPaths = func() []string {
+		paths := make([]string, 0, benchmarkResourceNum)
+		for i := 0; i < benchmarkResourceNum; i++ {
+			paths = append(paths, "/static/module"+strconv.Itoa(i)+"/")
+		}
+		return paths
+	}()
+	benchmarkRequestPaths = func() []string {
+		paths := make([]string, 0, 2*benchmarkResourceNum)
+		for i := 0; i < benchmarkResourceNum; i++ {
+			paths = append(paths, "/api/v1/resource"+strconv.Itoa(i)+"/list")
+			paths = append(paths, "/static/module"+strconv.Itoa(i)+"/js/app.js")
+		}
+		return paths
+	}()
+)
+
+func newBenchmarkRadixTree(b *testing.B) *RadixTree {
+	tree := NewRadixTree()
+	for _, path := range benchmarkStaticPaths {
+		err := tree.Insert(path, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, path := range benchmarkPrefixPaths {
+		err := tree.Insert(path+"**", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func BenchmarkRadixTreeMatchStatic(b *testing.B) {
+	tree := newBenchmarkRadixTree(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := tree.Match(benchmarkStaticPaths[i%len(benchmarkStaticPaths)]); !ok {
+			b.Fatal("should match")
+		}
+	}
+}
+
+func BenchmarkRadixTreeMatch(b *testing.B) {
+	tree := newBenchmarkRadixTree(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := tree.Match(benchmarkRequestPaths[i%len(benchmarkRequestPaths)]); !ok {
+			b.Fatal("should match")
+		}
+	}
+}
+
+func BenchmarkRadixTreeMatchRegex(b *testing.B) {
+	tree := NewRadixTree()
+	for i := 0; i < benchmarkResourceNum; i++ {
+		err := tree.Insert("/api/v1/resource"+strconv.Itoa(i)+"/:id<[0-9]+>/detail", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		path := "/api/v1/resource" + strconv.Itoa(i%benchmarkResourceNum) + "/42/detail"
+		if _, ok := tree.Match(path); !ok {
+			b.Fatal("should match")
+		}
+	}
+}
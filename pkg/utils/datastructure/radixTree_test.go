@@ -0,0 +1,118 @@
+package datastructure
+
+import (
+	"EH-Proxy/pkg/system/sysPrint"
+	"testing"
+)
+
+func TestRadixTreeMatch(t *testing.T) {
+	tree := NewRadixTree()
+	patterns := []string{
+		"/",
+		"/users",
+		"/users/list",
+		"/users/:id",
+		"/users/:id<[0-9]+>",
+		"/users/:id/profile",
+		"/users/*/settings",
+		"/api/v1/users",
+		"/api/v1/orders",
+		"/api/v2/**",
+		"/static/**file",
+		"/files/:name/**",
+	}
+	for _, pattern := range patterns {
+		err := tree.Insert(pattern, pattern)
+		if err != nil {
+			t.Fatalf("insert %s error:%v", pattern, err)
+		}
+	}
+	if tree.Len() != len(patterns) {
+		t.Errorf("size error, expect:%d, actual:%d", len(patterns), tree.Len())
+	}
+
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/", "/"},
+		{"/users", "/users"},
+		{"/users/list", "/users/list"},
+		{"/users/42", "/users/:id<[0-9]+>"},
+		{"/users/alice", "/users/:id"},
+		{"/users/alice/profile", "/users/:id/profile"},
+		{"/users/42/profile", "/users/:id/profile"},
+		{"/users/alice/settings", "/users/*/settings"},
+		{"/users/alice/other", ""},
+		{"/users/", ""},
+		{"/usersx", ""},
+		{"/api/v1/users", "/api/v1/users"},
+		{"/api/v1/orders", "/api/v1/orders"},
+		{"/api/v1", ""},
+		{"/api/v1/users/1", ""},
+		{"/api/v2", "/api/v2/**"},
+		{"/api/v2/a/b/c", "/api/v2/**"},
+		{"/static", "/static/**file"},
+		{"/static/js/app.js", "/static/**file"},
+		{"/staticfile", ""},
+		{"/files/a/b/c", "/files/:name/**"},
+		{"/files", ""},
+	}
+	for _, tt := range tests {
+		value, ok := tree.Match(tt.path)
+		if tt.pattern == "" {
+			if ok {
+				t.Errorf("path %s should not match, actual:%v", tt.path, value)
+			}
+			continue
+		}
+		if !ok || value != tt.pattern {
+			t.Errorf("match error, path:%s, expect:%s, actual:%v", tt.path, tt.pattern, value)
+		}
+	}
+}
+
+// TestRadixTreeBacktrack 更具体的分支在后续路径段匹配失败时回溯到其他分支
+func TestRadixTreeBacktrack(t *testing.T) {
+	tree := NewRadixTree()
+	for _, pattern := range []string{"/a/b/c", "/a/:x/d", "/a/**"} {
+		err := tree.Insert(pattern, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := map[string]string{
+		"/a/b/c": "/a/b/c",
+		"/a/b/d": "/a/:x/d",
+		"/a/b/e": "/a/**",
+		"/a/b":   "/a/**",
+	}
+	for path, expect := range tests {
+		value, ok := tree.Match(path)
+		if !ok || value != expect {
+			t.Errorf("match error, path:%s, expect:%s, actual:%v", path, expect, value)
+		}
+	}
+}
+
+func TestRadixTreeInsertError(t *testing.T) {
+	tree := NewRadixTree()
+	err := tree.Insert("/users/:id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Insert("/users/:id", nil)
+	if err != sysPrint.ErrPathPatternExists {
+		t.Errorf("expect ErrPathPatternExists, actual:%v", err)
+	}
+	for _, pattern := range []string{"users", "/static/**/a", "/users/:", "/users/:id<[0-9]+", "/users/:<[0-9]+>"} {
+		err = tree.Insert(pattern, nil)
+		if err != sysPrint.ErrPathPatternInvalid {
+			t.Errorf("pattern %s should be invalid, actual:%v", pattern, err)
+		}
+	}
+	err = tree.Insert("/users/:id<(>", nil)
+	if err == nil {
+		t.Error("invalid regex should fail")
+	}
+}
@@ -1,58 +0,0 @@
-package datastructure
-
-type TrieNode struct {
-	children map[rune]*TrieNode
-	isEnd    bool
-}
-
-type Trie struct {
-	root *TrieNode
-}
-
-func NewTrie() *Trie {
-	return &Trie{
-		root: &TrieNode{
-			children: make(map[rune]*TrieNode),
-			isEnd:    false,
-		},
-	}
-}
-
-func (t *Trie) Insert(word string) {
-	node := t.root
-	for _, ch := range word {
-		if node.children[ch] == nil {
-			node.children[ch] = &TrieNode{
-				children: make(map[rune]*TrieNode),
-				isEnd:    false,
-			}
-		}
-		node = node.children[ch]
-	}
-	node.isEnd = true
-}
-
-func (t *Trie) Search(word string) bool {
-	node := t.root
-	for _, ch := range word {
-		if node.children[ch] == nil {
-			return false
-		}
-		node = node.children[ch]
-	}
-	return node.isEnd
-}
-
-func (t *Trie) PrefixSearch(word string) bool {
-	node := t.root
-	for _, ch := range word {
-		if node.children[ch] == nil {
-			return false
-		}
-		node = node.children[ch]
-		if node.isEnd {
-			return true
-		}
-	}
-	return node.isEnd
-}